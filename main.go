@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
@@ -42,6 +43,11 @@ func main() {
 	}
 	defer store.Close()
 
+	// Config credentials only seed the first admin; later accounts live in the users table.
+	if err := store.EnsureAdmin(context.Background(), cfg.Auth.Username, cfg.Auth.Password); err != nil {
+		log.Fatalf("初始化管理员失败: %v", err)
+	}
+
 	s := server.New(cfg, logg, store)
 	router := s.Router()
 	addr := fmt.Sprintf("%s:%d", cfg.App.Host, cfg.App.Port)
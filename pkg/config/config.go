@@ -3,6 +3,7 @@ package config
 import (
 	"log"
 	"strings"
+	"time"
 
 	"github.com/fsnotify/fsnotify"
 	"github.com/spf13/viper"
@@ -16,12 +17,14 @@ type App struct {
 }
 
 type Auth struct {
-	Username string `mapstructure:"username"`
-	Password string `mapstructure:"password"`
+	Username   string        `mapstructure:"username"`
+	Password   string        `mapstructure:"password"`
+	SessionTTL time.Duration `mapstructure:"session_ttl"`
 }
 
 type Database struct {
-	Path string `mapstructure:"path"`
+	Path          string `mapstructure:"path"`
+	RetentionDays int    `mapstructure:"retention_days"`
 }
 
 type Logging struct {
@@ -46,6 +49,8 @@ func Load(path string) (*Config, error) {
 	v.SetDefault("app.host", "0.0.0.0")
 	v.SetDefault("app.port", 8080)
 	v.SetDefault("app.env", "development")
+	v.SetDefault("auth.session_ttl", "12h")
+	v.SetDefault("database.retention_days", 30)
 	v.SetDefault("logging.level", "info")
 	v.SetDefault("logging.file", "./logs/app.log")
 
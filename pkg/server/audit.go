@@ -0,0 +1,31 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+
+	"uveitis/backend/pkg/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (s *Server) listAudit(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	size, _ := strconv.Atoi(c.DefaultQuery("size", "50"))
+	rowID, _ := strconv.ParseInt(c.Query("row_id"), 10, 64)
+	entries, total, err := s.store.ListAudit(c.Request.Context(), storage.AuditFilter{
+		Table:    c.Query("table"),
+		RowID:    rowID,
+		Username: c.Query("username"),
+		Action:   c.Query("action"),
+		From:     c.Query("from"),
+		To:       c.Query("to"),
+		Page:     page,
+		PageSize: size,
+	})
+	if err != nil {
+		s.queryFail(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"items": entries, "total": total})
+}
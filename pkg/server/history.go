@@ -0,0 +1,81 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (s *Server) rowHistory(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+	versions, err := s.store.RowHistory(c.Request.Context(), c.Param("table"), id, c.Query("at"))
+	if err != nil {
+		s.queryFail(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"items": versions})
+}
+
+func (s *Server) rowVersion(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+	version, err := strconv.Atoi(c.Param("version"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+	v, err := s.store.RowVersionAt(c.Request.Context(), c.Param("table"), id, version)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, v)
+}
+
+func (s *Server) diffRowVersions(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+	from, err1 := strconv.Atoi(c.Query("from"))
+	to, err2 := strconv.Atoi(c.Query("to"))
+	if err1 != nil || err2 != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "需要 from 和 to 版本号"})
+		return
+	}
+	changes, err := s.store.DiffRowVersions(c.Request.Context(), c.Param("table"), id, from, to)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"changes": changes})
+}
+
+func (s *Server) revertRow(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+	var body struct {
+		Version int `json:"version"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil || body.Version <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "需要版本号"})
+		return
+	}
+	if err := s.store.RevertRow(c.Request.Context(), c.Param("table"), id, body.Version); err != nil {
+		s.fail(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "已恢复到指定版本"})
+}
@@ -0,0 +1,49 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (s *Server) normalizeDates(c *gin.Context) {
+	var body struct {
+		Table  string `json:"table"`
+		DryRun bool   `json:"dry_run"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求格式错误"})
+		return
+	}
+	report, err := s.store.NormalizeDates(c.Request.Context(), body.Table, body.DryRun)
+	if err != nil {
+		s.fail(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+func (s *Server) checkSchema(c *gin.Context) {
+	report, err := s.store.CheckSchema(c.Request.Context(), c.Query("table"), false)
+	if err != nil {
+		s.fail(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+func (s *Server) repairSchema(c *gin.Context) {
+	var body struct {
+		Table string `json:"table"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求格式错误"})
+		return
+	}
+	report, err := s.store.CheckSchema(c.Request.Context(), body.Table, true)
+	if err != nil {
+		s.fail(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
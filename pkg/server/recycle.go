@@ -0,0 +1,72 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (s *Server) deletedRows(c *gin.Context) {
+	rows, err := s.store.DeletedRows(c.Request.Context(), c.Param("table"))
+	if err != nil {
+		s.fail(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"items": rows})
+}
+
+func (s *Server) restoreRows(c *gin.Context) {
+	var body struct {
+		Ids []int64 `json:"ids"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil || len(body.Ids) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误，需要 id 列表"})
+		return
+	}
+	if err := s.store.RestoreRows(c.Request.Context(), c.Param("table"), body.Ids); err != nil {
+		s.fail(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "已恢复"})
+}
+
+func (s *Server) deletedTables(c *gin.Context) {
+	tables, err := s.store.DeletedTables(c.Request.Context())
+	if err != nil {
+		s.fail(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"items": tables})
+}
+
+func (s *Server) restoreTable(c *gin.Context) {
+	if err := s.store.RestoreTable(c.Request.Context(), c.Param("table")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "表已恢复"})
+}
+
+// purgeRecycleBin permanently deletes anything older than the retention period;
+// retention_days in the body overrides database.retention_days from config.
+func (s *Server) purgeRecycleBin(c *gin.Context) {
+	var body struct {
+		RetentionDays *int `json:"retention_days"`
+	}
+	_ = c.ShouldBindJSON(&body)
+	days := s.cfg.Database.RetentionDays
+	if body.RetentionDays != nil {
+		days = *body.RetentionDays
+	}
+	if days < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "保留天数不能为负数"})
+		return
+	}
+	res, err := s.store.Purge(c.Request.Context(), time.Duration(days)*24*time.Hour)
+	if err != nil {
+		s.fail(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
@@ -0,0 +1,106 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var dictionaryTypes = map[string]string{
+	"xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	"csv":  "text/csv; charset=utf-8",
+	"md":   "text/markdown; charset=utf-8",
+	"html": "text/html; charset=utf-8",
+}
+
+func (s *Server) schemaHistory(c *gin.Context) {
+	versions, err := s.store.SchemaHistory(c.Request.Context(), c.Param("table"), c.Query("at"))
+	if err != nil {
+		s.queryFail(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"items": versions})
+}
+
+func (s *Server) schemaVersion(c *gin.Context) {
+	version, err := strconv.Atoi(c.Param("version"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+	v, err := s.store.SchemaVersionAt(c.Request.Context(), c.Param("table"), version)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, v)
+}
+
+func (s *Server) diffSchemaVersions(c *gin.Context) {
+	from, err1 := strconv.Atoi(c.Query("from"))
+	to, err2 := strconv.Atoi(c.Query("to"))
+	if err1 != nil || err2 != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "需要 from 和 to 版本号"})
+		return
+	}
+	changes, err := s.store.DiffSchemaVersions(c.Request.Context(), c.Param("table"), from, to)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"changes": changes})
+}
+
+func (s *Server) schemaVersionDictionary(c *gin.Context) {
+	table := c.Param("table")
+	version, err := strconv.Atoi(c.Param("version"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+	format := c.DefaultQuery("format", "xlsx")
+	if _, ok := dictionaryTypes[format]; !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "不支持的格式 " + format})
+		return
+	}
+	data, displayName, err := s.store.SchemaVersionDictionary(c.Request.Context(), table, version, format)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	base := displayName
+	if base == "" {
+		base = table
+	}
+	sendDictionary(c, fmt.Sprintf("%s_数据字典_v%d", base, version), format, data)
+}
+
+func (s *Server) dictionary(c *gin.Context) {
+	table := c.Param("table")
+	format := c.DefaultQuery("format", "xlsx")
+	if _, ok := dictionaryTypes[format]; !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "不支持的格式 " + format})
+		return
+	}
+	data, displayName, err := s.store.Dictionary(c.Request.Context(), table, format)
+	if err != nil {
+		s.fail(c, err)
+		return
+	}
+	base := displayName
+	if base == "" {
+		base = table
+	}
+	sendDictionary(c, base+"_数据字典", format, data)
+}
+
+func sendDictionary(c *gin.Context, base, format string, data []byte) {
+	filename := fmt.Sprintf("%s_%s.%s", base, time.Now().Format("20060102150405"), format)
+	encoded := url.QueryEscape(filename)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"; filename*=UTF-8''%s", encoded, encoded))
+	c.Data(http.StatusOK, dictionaryTypes[format], data)
+}
@@ -3,8 +3,8 @@ package server
 import (
 	"bytes"
 	"context"
-	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -24,12 +24,10 @@ type Server struct {
 	cfg   *config.Config
 	log   *zap.Logger
 	store *storage.Storage
-	token string
 }
 
 func New(cfg *config.Config, log *zap.Logger, store *storage.Storage) *Server {
-	token := base64.StdEncoding.EncodeToString([]byte(cfg.Auth.Username + ":" + cfg.Auth.Password))
-	return &Server{cfg: cfg, log: log, store: store, token: token}
+	return &Server{cfg: cfg, log: log, store: store}
 }
 
 func (s *Server) Router() *gin.Engine {
@@ -43,26 +41,77 @@ func (s *Server) Router() *gin.Engine {
 	})
 
 	r.POST("/api/login", s.handleLogin)
+	r.POST("/api/refresh", s.refreshSession)
 
 	auth := r.Group("/api", s.authMiddleware())
 	{
 		auth.GET("/profile", s.profile)
+		auth.POST("/logout", s.logout)
 		auth.GET("/tables", s.listTables)
-		auth.POST("/tables", s.createTable)
-		auth.PUT("/tables/:table", s.updateTable)
-		auth.DELETE("/tables/:table", s.dropTable)
-		auth.POST("/tables/:table/clear", s.clearTable)
-		auth.POST("/tables/:table/export", s.exportTable)
-		auth.POST("/tables/:table/columns", s.addColumns)
-		auth.PUT("/tables/:table/columns", s.updateColumns)
-		auth.DELETE("/tables/:table/columns", s.dropColumns)
-		auth.GET("/tables/:table/data", s.queryData)
-		auth.POST("/tables/:table/data", s.insertRow)
-		auth.PUT("/tables/:table/data/:id", s.updateRow)
-		auth.DELETE("/tables/:table/data/:id", s.deleteRow)
-		auth.POST("/tables/:table/data/batch-delete", s.batchDeleteRows)
-		auth.POST("/tables/:table/import", s.importCSV)
-		auth.GET("/tables/:table/summary", s.summary)
+
+		read := auth.Group("", s.knownTable(), s.requireTable(storage.PermRead))
+		read.POST("/tables/:table/export", s.exportTable)
+		read.GET("/tables/:table/data", s.queryData)
+		read.GET("/tables/:table/summary", s.summary)
+		read.GET("/tables/:table/frequency", s.frequency)
+		read.GET("/tables/:table/crosstab", s.crosstab)
+		read.GET("/tables/:table/tests", s.hypothesisTest)
+		read.GET("/tables/:table/survival", s.survival)
+		read.GET("/tables/:table/timeseries", s.timeSeries)
+		read.GET("/tables/:table/data/:id/history", s.rowHistory)
+		read.GET("/tables/:table/data/:id/history/diff", s.diffRowVersions)
+		read.GET("/tables/:table/data/:id/history/:version", s.rowVersion)
+		read.GET("/tables/:table/dictionary", s.dictionary)
+		read.GET("/tables/:table/schema/versions", s.schemaHistory)
+		read.GET("/tables/:table/schema/versions/diff", s.diffSchemaVersions)
+		read.GET("/tables/:table/schema/versions/:version", s.schemaVersion)
+		read.GET("/tables/:table/schema/versions/:version/dictionary", s.schemaVersionDictionary)
+		read.GET("/tables/:table/recycle", s.deletedRows)
+		read.GET("/tables/:table/views", s.listViews)
+		read.POST("/tables/:table/views", s.createView)
+		read.PUT("/tables/:table/views/:view_id", s.updateView)
+		read.DELETE("/tables/:table/views/:view_id", s.deleteView)
+
+		write := auth.Group("", s.knownTable(), s.requireTable(storage.PermWrite))
+		write.POST("/tables/:table/data", s.insertRow)
+		write.PUT("/tables/:table/data/:id", s.updateRow)
+		write.DELETE("/tables/:table/data/:id", s.deleteRow)
+		write.POST("/tables/:table/data/batch-delete", s.batchDeleteRows)
+		write.POST("/tables/:table/import", s.importCSV)
+		write.POST("/tables/:table/data/:id/revert", s.revertRow)
+		write.POST("/tables/:table/recycle/restore", s.restoreRows)
+	}
+
+	admin := auth.Group("", s.requireAdmin())
+	{
+		admin.POST("/tables", s.createTable)
+
+		schema := admin.Group("", s.knownTable())
+		schema.PUT("/tables/:table", s.updateTable)
+		schema.DELETE("/tables/:table", s.dropTable)
+		schema.POST("/tables/:table/clear", s.clearTable)
+		schema.POST("/tables/:table/columns", s.addColumns)
+		schema.PUT("/tables/:table/columns", s.updateColumns)
+		schema.DELETE("/tables/:table/columns", s.dropColumns)
+		schema.POST("/tables/:table/columns/:column/convert", s.convertColumn)
+		schema.GET("/tables/:table/grants", s.listGrants)
+		schema.PUT("/tables/:table/grants", s.setGrants)
+
+		admin.GET("/audit", s.listAudit)
+		admin.GET("/recycle/tables", s.deletedTables)
+		admin.POST("/recycle/tables/:table/restore", s.restoreTable)
+		admin.POST("/recycle/purge", s.purgeRecycleBin)
+		admin.POST("/maintenance/normalize-dates", s.normalizeDates)
+		admin.GET("/maintenance/schema", s.checkSchema)
+		admin.POST("/maintenance/schema/repair", s.repairSchema)
+
+		admin.GET("/users", s.listUsers)
+		admin.POST("/users", s.createUser)
+		admin.PUT("/users/:id/disable", s.disableUser)
+		admin.PUT("/users/:id/enable", s.enableUser)
+		admin.PUT("/users/:id/role", s.setUserRole)
+		admin.POST("/users/:id/reset-password", s.resetPassword)
+		admin.POST("/users/:id/revoke-sessions", s.revokeSessions)
 	}
 	return r
 }
@@ -76,15 +125,48 @@ func (s *Server) handleLogin(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
 		return
 	}
-	if body.Username == s.cfg.Auth.Username && body.Password == s.cfg.Auth.Password {
-		c.JSON(http.StatusOK, gin.H{"token": s.token, "user": gin.H{"name": "管理员"}})
+	user, err := s.store.Authenticate(c.Request.Context(), body.Username, body.Password)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	token, expires, err := s.store.CreateSession(c.Request.Context(), user.ID, s.cfg.Auth.SessionTTL)
+	if err != nil {
+		s.fail(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"token": token, "expires_at": expires, "user": user})
+}
+
+func (s *Server) refreshSession(c *gin.Context) {
+	token, ok := bearerToken(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+		return
+	}
+	next, expires, err := s.store.RefreshSession(c.Request.Context(), token, s.cfg.Auth.SessionTTL)
+	if errors.Is(err, storage.ErrSessionInvalid) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		s.fail(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"token": next, "expires_at": expires})
+}
+
+func (s *Server) logout(c *gin.Context) {
+	token, _ := bearerToken(c)
+	if err := s.store.RevokeSession(c.Request.Context(), token); err != nil {
+		s.fail(c, err)
 		return
 	}
-	c.JSON(http.StatusUnauthorized, gin.H{"error": "用户名或密码错误"})
+	c.JSON(http.StatusOK, gin.H{"message": "已退出登录"})
 }
 
 func (s *Server) profile(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{"name": s.cfg.Auth.Username})
+	c.JSON(http.StatusOK, currentUser(c))
 }
 
 func (s *Server) listTables(c *gin.Context) {
@@ -95,6 +177,20 @@ func (s *Server) listTables(c *gin.Context) {
 		s.fail(c, err)
 		return
 	}
+	if user := currentUser(c); !user.IsAdmin() {
+		visible := tables[:0]
+		for _, t := range tables {
+			perm, err := s.store.TablePermission(ctx, user, t.Name)
+			if err != nil {
+				s.fail(c, err)
+				return
+			}
+			if storage.Allows(perm, storage.PermRead) {
+				visible = append(visible, t)
+			}
+		}
+		tables = visible
+	}
 	s.log.Info("api list tables success", zap.Int("count", len(tables)))
 	c.JSON(http.StatusOK, gin.H{"items": tables})
 }
@@ -125,10 +221,6 @@ func (s *Server) updateTable(c *gin.Context) {
 		schema.Name = table
 	}
 	if err := s.store.UpdateTable(ctx, table, schema); err != nil {
-		if strings.Contains(err.Error(), "不支持修改类型") {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-			return
-		}
 		s.fail(c, err)
 		return
 	}
@@ -186,29 +278,84 @@ func (s *Server) dropColumns(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "字段已删除"})
 }
 
+// convertColumn changes a column's type; with dry_run it only reports the values
+// that would not convert.
+func (s *Server) convertColumn(c *gin.Context) {
+	var req storage.ConvertRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.TypeHint == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求格式错误，需要 type_hint"})
+		return
+	}
+	req.Column = c.Param("column")
+	report, err := s.store.ConvertColumn(c.Request.Context(), c.Param("table"), req)
+	if err != nil && report != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "report": report})
+		return
+	}
+	if err != nil {
+		s.fail(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
 func (s *Server) queryData(c *gin.Context) {
 	ctx := c.Request.Context()
 	table := c.Param("table")
+	opts, ok := s.queryOptions(c)
+	if !ok {
+		return
+	}
+	res, err := s.store.Query(ctx, table, opts)
+	if err != nil {
+		s.queryFail(c, err)
+		return
+	}
+	resp := gin.H{"items": res.Items}
+	if !opts.SkipTotal {
+		resp["total"] = res.Total
+	}
+	if res.NextCursor != "" {
+		resp["next_cursor"] = res.NextCursor
+	}
+	if len(opts.Columns) > 0 {
+		resp["columns"] = opts.Columns
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// queryOptions reads the paging, search, sort and filter parameters shared by the
+// data and statistics endpoints, applying ?view= when given.
+func (s *Server) queryOptions(c *gin.Context) (storage.QueryOptions, bool) {
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
 	size, _ := strconv.Atoi(c.DefaultQuery("size", "20"))
 	desc := c.DefaultQuery("desc", "false") == "true"
-	opts := storage.QueryOptions{
-		Search:   c.Query("search"),
-		Page:     page,
-		PageSize: size,
-		SortBy:   c.Query("sort_by"),
-		Desc:     desc,
-		Filters:  mapFromQuery(c, "filter."),
-	}
-	rows, total, err := s.store.Query(ctx, table, opts)
+	where, err := parseWhere(c.Query("where"))
 	if err != nil {
-		s.fail(c, err)
-		return
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return storage.QueryOptions{}, false
 	}
-	c.JSON(http.StatusOK, gin.H{
-		"items": rows,
-		"total": total,
-	})
+	opts := storage.QueryOptions{
+		Search:    c.Query("search"),
+		Page:      page,
+		PageSize:  size,
+		SortBy:    c.Query("sort_by"),
+		Desc:      desc,
+		Filters:   mapFromQuery(c, "filter."),
+		Where:     where,
+		Columns:   splitList(c.Query("columns")),
+		Cursor:    c.Query("cursor"),
+		SkipTotal: c.Query("total") == "false",
+	}
+	if raw := c.Query("view"); raw != "" {
+		viewID, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "view 参数错误"})
+			return opts, false
+		}
+		return s.withView(c, c.Param("table"), viewID, opts)
+	}
+	return opts, true
 }
 
 func (s *Server) insertRow(c *gin.Context) {
@@ -351,14 +498,17 @@ func (s *Server) exportTable(c *gin.Context) {
 	ctx := c.Request.Context()
 	table := c.Param("table")
 	var body struct {
-		Ids     []int64           `json:"ids"`
-		Search  string            `json:"search"`
-		SortBy  string            `json:"sort_by"`
-		Desc    bool              `json:"desc"`
-		Page    int               `json:"page"`
-		Size    int               `json:"size"`
-		Filters map[string]string `json:"filters"`
-		All     bool              `json:"all"`
+		Ids     []int64             `json:"ids"`
+		Search  string              `json:"search"`
+		SortBy  string              `json:"sort_by"`
+		Desc    bool                `json:"desc"`
+		Page    int                 `json:"page"`
+		Size    int                 `json:"size"`
+		Filters map[string]string   `json:"filters"`
+		Where   *storage.FilterNode `json:"where"`
+		Columns []string            `json:"columns"`
+		View    int64               `json:"view"`
+		All     bool                `json:"all"`
 	}
 	if err := c.ShouldBindJSON(&body); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "请求格式错误"})
@@ -367,14 +517,22 @@ func (s *Server) exportTable(c *gin.Context) {
 	opts := storage.QueryOptions{
 		Search:   body.Search,
 		Filters:  body.Filters,
+		Where:    body.Where,
 		Page:     body.Page,
 		PageSize: body.Size,
 		SortBy:   body.SortBy,
 		Desc:     body.Desc,
+		Columns:  body.Columns,
+	}
+	if body.View > 0 {
+		var ok bool
+		if opts, ok = s.withView(c, table, body.View, opts); !ok {
+			return
+		}
 	}
 	data, displayName, err := s.store.ExportExcel(ctx, table, opts, body.Ids, body.All)
 	if err != nil {
-		s.fail(c, err)
+		s.queryFail(c, err)
 		return
 	}
 	base := displayName
@@ -396,12 +554,122 @@ func (s *Server) summary(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "缺少统计字段"})
 		return
 	}
-	res, err := s.store.Summary(ctx, table, column)
+	opts, ok := s.queryOptions(c)
+	if !ok {
+		return
+	}
+	var percentiles []float64
+	for _, item := range splitList(c.Query("percentiles")) {
+		p, err := strconv.ParseFloat(item, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "percentiles 参数错误"})
+			return
+		}
+		percentiles = append(percentiles, p)
+	}
+	res, err := s.store.Summary(ctx, table, storage.SummaryRequest{
+		Column:      column,
+		GroupBy:     c.Query("group_by"),
+		Percentiles: percentiles,
+	}, opts)
 	if err != nil {
-		s.fail(c, err)
+		s.queryFail(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+func (s *Server) frequency(c *gin.Context) {
+	column := c.Query("column")
+	if column == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "缺少统计字段"})
+		return
+	}
+	opts, ok := s.queryOptions(c)
+	if !ok {
+		return
+	}
+	res, err := s.store.Frequency(c.Request.Context(), c.Param("table"), column, opts)
+	if err != nil {
+		s.queryFail(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+func (s *Server) crosstab(c *gin.Context) {
+	rows, cols := c.Query("rows"), c.Query("cols")
+	if rows == "" || cols == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "需要指定行字段和列字段"})
+		return
+	}
+	opts, ok := s.queryOptions(c)
+	if !ok {
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"summary": res})
+	res, err := s.store.Crosstab(c.Request.Context(), c.Param("table"), rows, cols, opts)
+	if err != nil {
+		s.queryFail(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+func (s *Server) hypothesisTest(c *gin.Context) {
+	opts, ok := s.queryOptions(c)
+	if !ok {
+		return
+	}
+	res, err := s.store.HypothesisTest(c.Request.Context(), c.Param("table"), storage.TestRequest{
+		Test:    c.Query("test"),
+		Column:  c.Query("column"),
+		GroupBy: c.Query("group_by"),
+		Groups:  splitList(c.Query("groups")),
+		Rows:    c.Query("rows"),
+		Cols:    c.Query("cols"),
+	}, opts)
+	if err != nil {
+		s.queryFail(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+func (s *Server) survival(c *gin.Context) {
+	opts, ok := s.queryOptions(c)
+	if !ok {
+		return
+	}
+	res, err := s.store.Survival(c.Request.Context(), c.Param("table"), storage.SurvivalRequest{
+		Start:   c.Query("start"),
+		End:     c.Query("end"),
+		Event:   c.Query("event"),
+		GroupBy: c.Query("group_by"),
+		Groups:  splitList(c.Query("groups")),
+	}, opts)
+	if err != nil {
+		s.queryFail(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+func (s *Server) timeSeries(c *gin.Context) {
+	opts, ok := s.queryOptions(c)
+	if !ok {
+		return
+	}
+	res, err := s.store.TimeSeries(c.Request.Context(), c.Param("table"), storage.TimeSeriesRequest{
+		DateColumn: c.Query("date"),
+		Interval:   c.Query("interval"),
+		Column:     c.Query("column"),
+		Agg:        c.Query("agg"),
+	}, opts)
+	if err != nil {
+		s.queryFail(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, res)
 }
 
 func (s *Server) clearTable(c *gin.Context) {
@@ -425,26 +693,126 @@ func (s *Server) dropTable(c *gin.Context) {
 }
 
 func (s *Server) fail(c *gin.Context, err error) {
+	var ierr *storage.InputError
+	if errors.As(err, &ierr) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var cerr *storage.ConvertError
+	if errors.As(err, &cerr) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": cerr.Error(), "report": cerr.Report})
+		return
+	}
 	s.log.Error("api error", zap.String("path", c.FullPath()), zap.String("method", c.Request.Method), zap.Error(err))
+	var uerr *storage.UniqueError
+	if errors.As(err, &uerr) {
+		c.JSON(http.StatusConflict, gin.H{"error": uerr.Error(), "field": uerr.Field, "row_id": uerr.RowID})
+		return
+	}
+	var terr *storage.TableNotFoundError
+	if errors.As(err, &terr) {
+		c.JSON(http.StatusNotFound, gin.H{"error": terr.Error()})
+		return
+	}
 	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 }
 
+// queryFail answers 400 for malformed filters and falls back to fail otherwise.
+func (s *Server) queryFail(c *gin.Context, err error) {
+	var ferr *storage.FilterError
+	if errors.As(err, &ferr) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": ferr.Error()})
+		return
+	}
+	s.fail(c, err)
+}
+
 func (s *Server) authMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		header := c.GetHeader("Authorization")
-		if header == "" || !strings.HasPrefix(header, "Bearer ") {
+		token, ok := bearerToken(c)
+		if !ok {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
 			return
 		}
-		token := strings.TrimPrefix(header, "Bearer ")
-		if token != s.token {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "认证失败"})
+		user, err := s.store.SessionUser(c.Request.Context(), token)
+		if errors.Is(err, storage.ErrSessionInvalid) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			s.fail(c, err)
+			c.Abort()
 			return
 		}
+		c.Set(userKey, user)
+		c.Request = c.Request.WithContext(storage.WithActor(c.Request.Context(), storage.Actor{
+			UserID:   user.ID,
+			Username: user.Username,
+			ClientIP: c.ClientIP(),
+		}))
 		c.Next()
 	}
 }
 
+func (s *Server) requireAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !currentUser(c).IsAdmin() {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "需要管理员权限"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// knownTable rejects :table values that are not live user tables, which also keeps
+// the internal bookkeeping tables out of reach of every table endpoint.
+func (s *Server) knownTable() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := s.store.CheckTable(c.Request.Context(), c.Param("table")); err != nil {
+			s.fail(c, err)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// requireTable checks the current user's grant on the :table path parameter.
+func (s *Server) requireTable(required string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		perm, err := s.store.TablePermission(c.Request.Context(), currentUser(c), c.Param("table"))
+		if err != nil {
+			s.fail(c, err)
+			c.Abort()
+			return
+		}
+		if !storage.Allows(perm, required) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "无权访问该表"})
+			return
+		}
+		c.Next()
+	}
+}
+
+const userKey = "user"
+
+func bearerToken(c *gin.Context) (string, bool) {
+	header := c.GetHeader("Authorization")
+	if header == "" || !strings.HasPrefix(header, "Bearer ") {
+		return "", false
+	}
+	return strings.TrimPrefix(header, "Bearer "), true
+}
+
+func currentUser(c *gin.Context) *storage.User {
+	if v, ok := c.Get(userKey); ok {
+		if u, ok := v.(*storage.User); ok {
+			return u
+		}
+	}
+	return nil
+}
+
 func mapFromQuery(c *gin.Context, prefix string) map[string]string {
 	result := map[string]string{}
 	for key, vals := range c.Request.URL.Query() {
@@ -455,6 +823,29 @@ func mapFromQuery(c *gin.Context, prefix string) map[string]string {
 	return result
 }
 
+// splitList splits a comma separated query parameter, dropping empty items.
+func splitList(raw string) []string {
+	var out []string
+	for _, item := range strings.Split(raw, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// parseWhere decodes the JSON filter tree passed as ?where=.
+func parseWhere(raw string) (*storage.FilterNode, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	var node storage.FilterNode
+	if err := json.Unmarshal([]byte(raw), &node); err != nil {
+		return nil, errors.New("where 参数不是有效的 JSON")
+	}
+	return &node, nil
+}
+
 func allowUnknown(c *gin.Context) bool {
 	val := c.DefaultPostForm("allow_unknown", c.Query("allow_unknown"))
 	return val == "1" || strings.ToLower(val) == "true"
@@ -0,0 +1,149 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+
+	"uveitis/backend/pkg/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (s *Server) listUsers(c *gin.Context) {
+	users, err := s.store.ListUsers(c.Request.Context())
+	if err != nil {
+		s.fail(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"items": users})
+}
+
+func (s *Server) createUser(c *gin.Context) {
+	var body struct {
+		Username    string `json:"username"`
+		Password    string `json:"password"`
+		DisplayName string `json:"display_name"`
+		Role        string `json:"role"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求格式错误"})
+		return
+	}
+	id, err := s.store.CreateUser(c.Request.Context(), storage.User{
+		Username:    body.Username,
+		DisplayName: body.DisplayName,
+		Role:        body.Role,
+	}, body.Password)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"id": id})
+}
+
+func (s *Server) disableUser(c *gin.Context) {
+	s.setUserDisabled(c, true)
+}
+
+func (s *Server) enableUser(c *gin.Context) {
+	s.setUserDisabled(c, false)
+}
+
+func (s *Server) setUserDisabled(c *gin.Context, disabled bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+	if disabled && currentUser(c).ID == id {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "不能停用当前登录账号"})
+		return
+	}
+	if err := s.store.SetUserDisabled(c.Request.Context(), id, disabled); err != nil {
+		s.fail(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "已更新"})
+}
+
+func (s *Server) resetPassword(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+	var body struct {
+		Password string `json:"password"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil || body.Password == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "密码不能为空"})
+		return
+	}
+	if err := s.store.ResetPassword(c.Request.Context(), id, body.Password); err != nil {
+		s.fail(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "密码已重置"})
+}
+
+func (s *Server) setUserRole(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+	var body struct {
+		Role string `json:"role"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求格式错误"})
+		return
+	}
+	if currentUser(c).ID == id && body.Role != storage.RoleAdmin {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "不能取消当前账号的管理员角色"})
+		return
+	}
+	if err := s.store.SetUserRole(c.Request.Context(), id, body.Role); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "已更新"})
+}
+
+func (s *Server) listGrants(c *gin.Context) {
+	grants, err := s.store.ListGrants(c.Request.Context(), c.Param("table"))
+	if err != nil {
+		s.fail(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"items": grants})
+}
+
+func (s *Server) setGrants(c *gin.Context) {
+	var body struct {
+		Grants []storage.TableGrant `json:"grants"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求格式错误"})
+		return
+	}
+	if err := s.store.SetGrants(c.Request.Context(), c.Param("table"), body.Grants); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "权限已更新"})
+}
+
+func (s *Server) revokeSessions(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+	n, err := s.store.RevokeUserSessions(c.Request.Context(), id)
+	if err != nil {
+		s.fail(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"revoked": n})
+}
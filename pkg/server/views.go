@@ -0,0 +1,134 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+
+	"uveitis/backend/pkg/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+type viewPayload struct {
+	Name    string               `json:"name"`
+	Options storage.QueryOptions `json:"options"`
+	Columns []string             `json:"columns"`
+}
+
+func (s *Server) listViews(c *gin.Context) {
+	views, err := s.store.ListViews(c.Request.Context(), c.Param("table"))
+	if err != nil {
+		s.fail(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"items": views})
+}
+
+func (s *Server) createView(c *gin.Context) {
+	var body viewPayload
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求格式错误"})
+		return
+	}
+	id, err := s.store.CreateView(c.Request.Context(), storage.SavedView{
+		TableName: c.Param("table"),
+		Name:      body.Name,
+		Options:   body.Options,
+		Columns:   body.Columns,
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"id": id})
+}
+
+func (s *Server) updateView(c *gin.Context) {
+	view, ok := s.ownedView(c)
+	if !ok {
+		return
+	}
+	var body viewPayload
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求格式错误"})
+		return
+	}
+	view.Name, view.Options, view.Columns = body.Name, body.Options, body.Columns
+	if err := s.store.UpdateView(c.Request.Context(), *view); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "视图已更新"})
+}
+
+func (s *Server) deleteView(c *gin.Context) {
+	view, ok := s.ownedView(c)
+	if !ok {
+		return
+	}
+	if err := s.store.DeleteView(c.Request.Context(), view.TableName, view.ID); err != nil {
+		s.fail(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "视图已删除"})
+}
+
+// ownedView loads the :view_id view and checks that the caller may change it.
+func (s *Server) ownedView(c *gin.Context) (*storage.SavedView, bool) {
+	id, err := strconv.ParseInt(c.Param("view_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return nil, false
+	}
+	view, err := s.store.GetView(c.Request.Context(), c.Param("table"), id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	user := currentUser(c)
+	if !user.IsAdmin() && view.OwnerID != user.ID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "只能修改自己创建的视图"})
+		return nil, false
+	}
+	return view, true
+}
+
+// withView layers the request's options on top of a saved view: paging always
+// comes from the request, search/sort replace the view's when given, and
+// filters are combined with the view's.
+func (s *Server) withView(c *gin.Context, table string, viewID int64, req storage.QueryOptions) (storage.QueryOptions, bool) {
+	view, err := s.store.GetView(c.Request.Context(), table, viewID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return req, false
+	}
+	opts := view.Apply()
+	opts.Page, opts.PageSize, opts.Cursor = req.Page, req.PageSize, req.Cursor
+	opts.SkipTotal = req.SkipTotal
+	if req.Search != "" {
+		opts.Search = req.Search
+	}
+	if req.SortBy != "" {
+		opts.SortBy, opts.Desc = req.SortBy, req.Desc
+	}
+	if len(req.Filters) > 0 {
+		merged := map[string]string{}
+		for k, v := range opts.Filters {
+			merged[k] = v
+		}
+		for k, v := range req.Filters {
+			merged[k] = v
+		}
+		opts.Filters = merged
+	}
+	switch {
+	case req.Where != nil && opts.Where != nil:
+		opts.Where = &storage.FilterNode{Op: "and", Children: []storage.FilterNode{*opts.Where, *req.Where}}
+	case req.Where != nil:
+		opts.Where = req.Where
+	}
+	if len(req.Columns) > 0 {
+		opts.Columns = req.Columns
+	}
+	return opts, true
+}
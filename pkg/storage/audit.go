@@ -0,0 +1,253 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	AuditInsert        = "insert"
+	AuditUpdate        = "update"
+	AuditDelete        = "delete"
+	AuditClear         = "clear"
+	AuditImport        = "import"
+	AuditCreateTable   = "create_table"
+	AuditUpdateTable   = "update_table"
+	AuditDropTable     = "drop_table"
+	AuditAddColumns    = "add_columns"
+	AuditUpdateColumns = "update_columns"
+	AuditDropColumns   = "drop_columns"
+)
+
+// Actor identifies who triggered a mutation; the server puts it on the request context.
+type Actor struct {
+	UserID   int64
+	Username string
+	ClientIP string
+}
+
+type actorKey struct{}
+
+func WithActor(ctx context.Context, a Actor) context.Context {
+	return context.WithValue(ctx, actorKey{}, a)
+}
+
+func actorFrom(ctx context.Context) Actor {
+	a, _ := ctx.Value(actorKey{}).(Actor)
+	return a
+}
+
+type AuditEntry struct {
+	ID        int64           `json:"id"`
+	Time      string          `json:"time"`
+	UserID    int64           `json:"user_id"`
+	Username  string          `json:"username"`
+	ClientIP  string          `json:"client_ip"`
+	Action    string          `json:"action"`
+	TableName string          `json:"table_name"`
+	RowID     int64           `json:"row_id,omitempty"`
+	Before    json.RawMessage `json:"before,omitempty"`
+	After     json.RawMessage `json:"after,omitempty"`
+}
+
+type AuditFilter struct {
+	Table    string
+	RowID    int64
+	Username string
+	Action   string
+	From     string
+	To       string
+	Page     int
+	PageSize int
+}
+
+// execer is satisfied by both *sql.DB and *sql.Tx so audit rows can join the caller's transaction.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+func (s *Storage) ensureAudit() error {
+	ddl := []string{
+		`CREATE TABLE IF NOT EXISTS audit_log (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			ts DATETIME DEFAULT CURRENT_TIMESTAMP,
+			user_id INTEGER,
+			username TEXT,
+			client_ip TEXT,
+			action TEXT NOT NULL,
+			table_name TEXT,
+			row_id INTEGER,
+			before_json TEXT,
+			after_json TEXT
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_table_row ON audit_log(table_name, row_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_ts ON audit_log(ts);`,
+		// The log is append-only.
+		`CREATE TRIGGER IF NOT EXISTS audit_log_no_update BEFORE UPDATE ON audit_log
+			BEGIN SELECT RAISE(ABORT, 'audit log is immutable'); END;`,
+		`CREATE TRIGGER IF NOT EXISTS audit_log_no_delete BEFORE DELETE ON audit_log
+			BEGIN SELECT RAISE(ABORT, 'audit log is immutable'); END;`,
+	}
+	for _, stmt := range ddl {
+		if _, err := s.db.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Storage) audit(ctx context.Context, q execer, action, table string, rowID int64, before, after any) error {
+	a := actorFrom(ctx)
+	b, err := auditJSON(before)
+	if err != nil {
+		return err
+	}
+	af, err := auditJSON(after)
+	if err != nil {
+		return err
+	}
+	var row any
+	if rowID > 0 {
+		row = rowID
+	}
+	if _, err := q.ExecContext(ctx, `INSERT INTO audit_log(user_id, username, client_ip, action, table_name, row_id, before_json, after_json)
+		VALUES(?,?,?,?,?,?,?,?)`, a.UserID, a.Username, a.ClientIP, action, table, row, b, af); err != nil {
+		s.l.Error("write audit failed", zap.String("action", action), zap.String("table", table), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func auditJSON(v any) (any, error) {
+	if v == nil || reflectNil(v) {
+		return nil, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// auditRows writes one delete record per row snapshot.
+func (s *Storage) auditRows(ctx context.Context, q execer, action, table string, rows []map[string]any) error {
+	for _, r := range rows {
+		id, _ := r["id"].(int64)
+		if err := s.audit(ctx, q, action, table, id, r, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Storage) ListAudit(ctx context.Context, f AuditFilter) ([]AuditEntry, int, error) {
+	if f.Page < 1 {
+		f.Page = 1
+	}
+	if f.PageSize <= 0 {
+		f.PageSize = 50
+	}
+	var clauses []string
+	var params []any
+	if f.Table != "" {
+		clauses = append(clauses, "table_name=?")
+		params = append(params, f.Table)
+	}
+	if f.RowID > 0 {
+		clauses = append(clauses, "row_id=?")
+		params = append(params, f.RowID)
+	}
+	if f.Username != "" {
+		clauses = append(clauses, "username=?")
+		params = append(params, f.Username)
+	}
+	if f.Action != "" {
+		clauses = append(clauses, "action=?")
+		params = append(params, f.Action)
+	}
+	if f.From != "" {
+		from, err := auditTime(f.From, false)
+		if err != nil {
+			return nil, 0, err
+		}
+		clauses = append(clauses, "ts>=?")
+		params = append(params, from)
+	}
+	if f.To != "" {
+		to, err := auditTime(f.To, true)
+		if err != nil {
+			return nil, 0, err
+		}
+		clauses = append(clauses, "ts<=?")
+		params = append(params, to)
+	}
+	where := ""
+	if len(clauses) > 0 {
+		where = "WHERE " + strings.Join(clauses, " AND ")
+	}
+	var total int
+	if err := s.db.QueryRowContext(ctx, "SELECT COUNT(1) FROM audit_log "+where, params...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	offset := (f.Page - 1) * f.PageSize
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(`SELECT id, strftime('%%Y-%%m-%%d %%H:%%M:%%S', ts), COALESCE(user_id,0), COALESCE(username,''), COALESCE(client_ip,''),
+		action, COALESCE(table_name,''), COALESCE(row_id,0), before_json, after_json
+		FROM audit_log %s ORDER BY id DESC LIMIT %d OFFSET %d`, where, f.PageSize, offset), params...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	var entries []AuditEntry
+	for rows.Next() {
+		var e AuditEntry
+		var before, after sql.NullString
+		if err := rows.Scan(&e.ID, &e.Time, &e.UserID, &e.Username, &e.ClientIP, &e.Action, &e.TableName, &e.RowID, &before, &after); err != nil {
+			return nil, 0, err
+		}
+		if before.Valid {
+			e.Before = json.RawMessage(before.String)
+		}
+		if after.Valid {
+			e.After = json.RawMessage(after.String)
+		}
+		entries = append(entries, e)
+	}
+	return entries, total, rows.Err()
+}
+
+// auditTime accepts a date or RFC3339 time and renders it in the UTC layout used by
+// CURRENT_TIMESTAMP. A bare date used as an upper bound covers the whole day.
+func auditTime(v string, endOfDay bool) (string, error) {
+	v = strings.TrimSpace(v)
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t.UTC().Format("2006-01-02 15:04:05"), nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02 15:04:05", v, time.Local); err == nil {
+		return t.UTC().Format("2006-01-02 15:04:05"), nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", v, time.Local); err == nil {
+		if endOfDay {
+			t = t.Add(24*time.Hour - time.Second)
+		}
+		return t.UTC().Format("2006-01-02 15:04:05"), nil
+	}
+	return "", inputErr("无法识别的时间: %s", v)
+}
+
+func reflectNil(v any) bool {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Map, reflect.Slice, reflect.Pointer, reflect.Interface:
+		return rv.IsNil()
+	}
+	return false
+}
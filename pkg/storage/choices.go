@@ -0,0 +1,161 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Choice fields keep their option list in column_meta.options. A single-choice
+// (enum/单选) cell stores one option code; a multi-choice (multi/多选) cell stores
+// a JSON array of codes in option order, so SQLite's json_each can test membership.
+
+type FieldOption struct {
+	Code  string `json:"code"`
+	Label string `json:"label"`
+}
+
+func isChoiceHint(typeHint string) bool {
+	return isEnumHint(typeHint) || isMultiHint(typeHint)
+}
+
+func isEnumHint(typeHint string) bool {
+	switch strings.ToLower(typeHint) {
+	case "enum", "单选":
+		return true
+	}
+	return false
+}
+
+func isMultiHint(typeHint string) bool {
+	switch strings.ToLower(typeHint) {
+	case "multi", "多选":
+		return true
+	}
+	return false
+}
+
+// validateOptions checks that choice fields have a usable option list and that
+// other fields have none.
+func validateOptions(f FieldDefinition) error {
+	if !isChoiceHint(f.TypeHint) {
+		if len(f.Options) > 0 {
+			return fmt.Errorf("字段 %s 不是选项类型，不能设置选项", f.Name)
+		}
+		return nil
+	}
+	if len(f.Options) == 0 {
+		return fmt.Errorf("字段 %s 需要至少一个选项", f.Name)
+	}
+	seen := map[string]bool{}
+	for _, o := range f.Options {
+		code := strings.TrimSpace(o.Code)
+		if code == "" {
+			return fmt.Errorf("字段 %s 的选项代码不能为空", f.Name)
+		}
+		key := strings.ToLower(code)
+		if seen[key] {
+			return fmt.Errorf("字段 %s 的选项代码重复: %s", f.Name, code)
+		}
+		seen[key] = true
+	}
+	return nil
+}
+
+func optionsJSON(options []FieldOption) string {
+	if len(options) == 0 {
+		return ""
+	}
+	raw, _ := json.Marshal(options)
+	return string(raw)
+}
+
+// matchOption finds an option by code or Chinese label, ignoring case and spaces.
+func (f FieldDefinition) matchOption(v string) (int, bool) {
+	v = strings.TrimSpace(v)
+	for i, o := range f.Options {
+		if strings.EqualFold(o.Code, v) || (o.Label != "" && strings.EqualFold(o.Label, v)) {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+func (f FieldDefinition) optionCode(v any) (string, error) {
+	text := strings.TrimSpace(fmt.Sprint(v))
+	i, ok := f.matchOption(text)
+	if !ok {
+		return "", fmt.Errorf("%s 不是有效选项", text)
+	}
+	return f.Options[i].Code, nil
+}
+
+// choiceValue converts codes or labels to the stored form. Multi-choice input may
+// be a JSON array or text separated by commas, semicolons, 、 or |.
+func (f FieldDefinition) choiceValue(val any) (any, error) {
+	if val == nil {
+		return nil, nil
+	}
+	if isEnumHint(f.TypeHint) {
+		if s, ok := val.(string); ok && strings.TrimSpace(s) == "" {
+			return nil, nil
+		}
+		return f.optionCode(val)
+	}
+	var items []any
+	switch v := val.(type) {
+	case []any:
+		items = v
+	case []string:
+		for _, s := range v {
+			items = append(items, s)
+		}
+	case string:
+		text := strings.TrimSpace(v)
+		var arr []any
+		if strings.HasPrefix(text, "[") && json.Unmarshal([]byte(text), &arr) == nil {
+			items = arr
+			break
+		}
+		for _, part := range strings.FieldsFunc(text, func(r rune) bool {
+			return strings.ContainsRune(",，;；、|", r)
+		}) {
+			if part = strings.TrimSpace(part); part != "" {
+				items = append(items, part)
+			}
+		}
+	default:
+		items = []any{v}
+	}
+	picked := make([]bool, len(f.Options))
+	count := 0
+	for _, item := range items {
+		i, ok := f.matchOption(fmt.Sprint(item))
+		if !ok {
+			return nil, fmt.Errorf("%v 不是有效选项", item)
+		}
+		if !picked[i] {
+			picked[i] = true
+			count++
+		}
+	}
+	if count == 0 {
+		return nil, nil
+	}
+	codes := make([]string, 0, count)
+	for i, ok := range picked {
+		if ok {
+			codes = append(codes, f.Options[i].Code)
+		}
+	}
+	raw, _ := json.Marshal(codes)
+	return string(raw), nil
+}
+
+// convertField is convertValue with the option list available for choice fields.
+func convertField(f FieldDefinition, val any) (any, error) {
+	if isChoiceHint(f.TypeHint) {
+		return f.choiceValue(val)
+	}
+	return convertValue(f.TypeHint, val)
+}
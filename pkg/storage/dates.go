@@ -0,0 +1,252 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const AuditNormalizeDates = "normalize_dates"
+
+const (
+	isoDate     = "2006-01-02"
+	isoDateTime = "2006-01-02T15:04:05"
+)
+
+// dateLayouts are the date spellings found in clinical spreadsheets, tried in order.
+var dateLayouts = []string{
+	"2006-01-02",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006/01/02",
+	"2006/1/2",
+	"2006/01/02 15:04:05",
+	"2006/1/2 15:04:05",
+	"2006/1/2 15:04",
+	"2006.01.02",
+	"2006.1.2",
+	"2006-1-2",
+	"20060102",
+	"2006年1月2日",
+	"2006年1月2日 15:04:05",
+}
+
+// excelEpoch is day 0 of Excel's 1900 date system (serial 1 is 1900-01-01; the
+// fictitious 1900-02-29 only shifts dates before March 1900).
+var excelEpoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+// parseDate reads a date cell as stored or submitted: text in one of dateLayouts,
+// a time value, or yyyymmdd written as a number. Bare numbers are not taken as
+// Excel serials here; only numeric xlsx cells are, see excelSerialDate.
+// Zone-less values are read as UTC so day differences are not affected by DST.
+func parseDate(v any) (time.Time, bool) {
+	switch x := v.(type) {
+	case time.Time:
+		return x, true
+	case []byte:
+		return parseDate(string(x))
+	case int64:
+		return dateFromNumber(float64(x))
+	case int:
+		return dateFromNumber(float64(x))
+	case float64:
+		return dateFromNumber(x)
+	case string:
+		text := strings.TrimSpace(x)
+		if text == "" {
+			return time.Time{}, false
+		}
+		for _, layout := range dateLayouts {
+			if t, err := time.ParseInLocation(layout, text, time.UTC); err == nil {
+				return t, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// dateFromNumber accepts yyyymmdd written as a number.
+func dateFromNumber(f float64) (time.Time, bool) {
+	if f < 10000101 || f > 99991231 || f != math.Trunc(f) {
+		return time.Time{}, false
+	}
+	t, err := time.Parse("20060102", strconv.FormatInt(int64(f), 10))
+	return t, err == nil
+}
+
+// excelSerialDate reads the raw value of a numeric xlsx cell as an Excel serial,
+// up to the year 2173.
+func excelSerialDate(raw string) (time.Time, bool) {
+	f, err := strconv.ParseFloat(strings.TrimSpace(raw), 64)
+	if err != nil || f < 1 || f >= 100000 {
+		return time.Time{}, false
+	}
+	days := math.Trunc(f)
+	secs := math.Round((f - days) * 86400)
+	return excelEpoch.AddDate(0, 0, int(days)).Add(time.Duration(secs) * time.Second), true
+}
+
+// normalizeDate renders a date value in ISO-8601: 2006-01-02 for date columns and
+// 2006-01-02T15:04:05 for datetime columns. Values carrying a zone keep the wall
+// time they were written in.
+func normalizeDate(typeHint string, val any) (any, error) {
+	if s, ok := val.(string); ok && strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	t, ok := parseDate(val)
+	if !ok {
+		return nil, fmt.Errorf("无法识别的日期 %v，请使用 2024-03-05 格式", val)
+	}
+	return formatDate(typeHint, t), nil
+}
+
+func formatDate(typeHint string, t time.Time) string {
+	switch strings.ToLower(typeHint) {
+	case "datetime", "时间":
+		return t.Format(isoDateTime)
+	}
+	return t.Format(isoDate)
+}
+
+func isDateHint(typeHint string) bool {
+	switch strings.ToLower(typeHint) {
+	case "date", "datetime", "日期", "时间":
+		return true
+	}
+	return false
+}
+
+// DateIssue is a stored value that could not be read as a date.
+type DateIssue struct {
+	Table  string `json:"table"`
+	RowID  int64  `json:"row_id"`
+	Column string `json:"column"`
+	Value  string `json:"value"`
+}
+
+// NormalizeReport summarizes a date migration. Issues is capped at maxDateIssues;
+// Unparseable is the full count.
+type NormalizeReport struct {
+	DryRun      bool        `json:"dry_run"`
+	Tables      []string    `json:"tables"`
+	Changed     int         `json:"changed"`
+	Unchanged   int         `json:"unchanged"`
+	Unparseable int         `json:"unparseable"`
+	Issues      []DateIssue `json:"issues"`
+}
+
+const maxDateIssues = 200
+
+// NormalizeDates rewrites the date and datetime columns of one table (or of all
+// tables when table is empty) in ISO-8601, including rows in the recycle bin.
+// Values that cannot be parsed are left as they are and reported. With dryRun
+// nothing is written.
+func (s *Storage) NormalizeDates(ctx context.Context, table string, dryRun bool) (*NormalizeReport, error) {
+	var tables []string
+	if table != "" {
+		if err := s.CheckTable(ctx, table); err != nil {
+			return nil, err
+		}
+		tables = []string{table}
+	} else {
+		all, err := s.ListTables(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range all {
+			tables = append(tables, t.Name)
+		}
+	}
+	report := &NormalizeReport{DryRun: dryRun, Tables: tables, Issues: []DateIssue{}}
+	for _, t := range tables {
+		if err := s.normalizeTableDates(ctx, t, dryRun, report); err != nil {
+			return nil, err
+		}
+	}
+	s.l.Info("normalize dates", zap.Strings("tables", tables), zap.Bool("dry_run", dryRun),
+		zap.Int("changed", report.Changed), zap.Int("unparseable", report.Unparseable))
+	return report, nil
+}
+
+func (s *Storage) normalizeTableDates(ctx context.Context, table string, dryRun bool, report *NormalizeReport) error {
+	fields, err := s.listColumns(ctx, table)
+	if err != nil {
+		return err
+	}
+	var dateCols []FieldDefinition
+	for _, f := range fields {
+		if isDateHint(f.TypeHint) {
+			dateCols = append(dateCols, f)
+		}
+	}
+	if len(dateCols) == 0 {
+		return nil
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	rows, err := selectRows(ctx, tx, fmt.Sprintf("SELECT * FROM %s ORDER BY id", quoteIdent(table)))
+	if err != nil {
+		return err
+	}
+	changedRows := 0
+	for _, row := range rows {
+		id, _ := row["id"].(int64)
+		updates := map[string]any{}
+		for _, f := range dateCols {
+			raw := row[f.Name]
+			if raw == nil || strings.TrimSpace(fmt.Sprint(raw)) == "" {
+				continue
+			}
+			norm, err := normalizeDate(f.TypeHint, raw)
+			if err != nil {
+				report.Unparseable++
+				if len(report.Issues) < maxDateIssues {
+					report.Issues = append(report.Issues, DateIssue{Table: table, RowID: id, Column: f.Name, Value: fmt.Sprint(raw)})
+				}
+				continue
+			}
+			if norm == raw {
+				report.Unchanged++
+				continue
+			}
+			updates[f.Name] = norm
+			report.Changed++
+		}
+		if len(updates) == 0 || dryRun {
+			continue
+		}
+		var sets []string
+		var args []any
+		for col, v := range updates {
+			sets = append(sets, quoteIdent(col)+"=?")
+			args = append(args, v)
+			row[col] = v
+		}
+		args = append(args, id)
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf("UPDATE %s SET %s WHERE id=?", quoteIdent(table), strings.Join(sets, ", ")), args...); err != nil {
+			return uniqueError(ctx, tx, table, err, updates, id)
+		}
+		if err := s.recordVersion(ctx, tx, AuditNormalizeDates, table, id, row); err != nil {
+			return err
+		}
+		changedRows++
+	}
+	if dryRun || changedRows == 0 {
+		return nil
+	}
+	if err := s.audit(ctx, tx, AuditNormalizeDates, table, 0, nil, map[string]any{"rows": changedRows}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,398 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// A data dictionary (codebook) lists one row per field: name, labels, type,
+// allowed values, whether it is required, default, validation rules and the
+// field's description.
+
+var dictionaryHeader = []string{"字段名", "中文名", "别名", "类型", "可选值", "必填", "默认值", "校验规则", "唯一", "索引", "说明"}
+
+func dictionaryRows(schema TableSchema) [][]string {
+	rows := make([][]string, 0, len(schema.Fields))
+	for _, f := range schema.Fields {
+		var label, aliases string
+		if len(f.Labels) > 0 {
+			label, aliases = f.Labels[0], strings.Join(f.Labels[1:], "、")
+		}
+		var options []string
+		for _, o := range f.Options {
+			options = append(options, ternary(o.Label == "" || o.Label == o.Code, o.Code, o.Code+"="+o.Label))
+		}
+		rows = append(rows, []string{
+			f.Name, label, aliases, f.TypeHint, strings.Join(options, "；"),
+			requiredText(f), f.Default, rulesText(f.Rules),
+			ternary(f.Unique, "是", ""), ternary(f.Indexed, "是", ""), f.Description,
+		})
+	}
+	return rows
+}
+
+func requiredText(f FieldDefinition) string {
+	if !f.AllowNull {
+		return "是"
+	}
+	if f.Rules == nil || f.Rules.RequiredIf == nil {
+		return "否"
+	}
+	cond := f.Rules.RequiredIf
+	if len(cond.Values) == 0 {
+		return fmt.Sprintf("%s 有值时必填", cond.Field)
+	}
+	values := make([]string, len(cond.Values))
+	for i, v := range cond.Values {
+		values[i] = fmt.Sprint(v)
+	}
+	return fmt.Sprintf("%s 为 %s 时必填", cond.Field, strings.Join(values, "/"))
+}
+
+func rulesText(r *FieldRules) string {
+	if r == nil {
+		return ""
+	}
+	num := func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
+	var parts []string
+	switch {
+	case r.Min != nil && r.Max != nil:
+		parts = append(parts, fmt.Sprintf("范围 %s ~ %s", num(*r.Min), num(*r.Max)))
+	case r.Min != nil:
+		parts = append(parts, "不小于 "+num(*r.Min))
+	case r.Max != nil:
+		parts = append(parts, "不大于 "+num(*r.Max))
+	}
+	switch {
+	case r.MinLength > 0 && r.MaxLength > 0:
+		parts = append(parts, fmt.Sprintf("长度 %d ~ %d", r.MinLength, r.MaxLength))
+	case r.MinLength > 0:
+		parts = append(parts, fmt.Sprintf("长度不少于 %d", r.MinLength))
+	case r.MaxLength > 0:
+		parts = append(parts, fmt.Sprintf("长度不超过 %d", r.MaxLength))
+	}
+	if r.Pattern != "" {
+		parts = append(parts, "格式 "+r.Pattern)
+	}
+	return strings.Join(parts, "；")
+}
+
+// dictionaryDoc is a rendered dictionary: Title, Description and Note head every
+// format, as a heading and paragraphs in Markdown and HTML and as leading rows
+// followed by a blank one in xlsx and csv.
+type dictionaryDoc struct {
+	Title       string
+	Description string
+	Note        string
+	Header      []string
+	Rows        [][]string
+}
+
+func newDictionaryDoc(schema TableSchema, note string) *dictionaryDoc {
+	title := schema.Name
+	if schema.DisplayName != "" {
+		title = fmt.Sprintf("%s（%s）", schema.DisplayName, schema.Name)
+	}
+	return &dictionaryDoc{
+		Title:       title,
+		Description: schema.Description,
+		Note:        note,
+		Header:      slices.Clone(dictionaryHeader),
+		Rows:        dictionaryRows(schema),
+	}
+}
+
+// render writes the dictionary as xlsx, csv (with a BOM so Excel reads the
+// Chinese text correctly), Markdown or a self-contained HTML page meant to be
+// printed to PDF from the browser.
+func (d *dictionaryDoc) render(format string) ([]byte, error) {
+	var buf bytes.Buffer
+	switch format {
+	case "xlsx":
+		f := excelize.NewFile()
+		sheet := f.GetSheetName(f.GetActiveSheetIndex())
+		for r, row := range d.table() {
+			for c, v := range row {
+				_ = f.SetCellValue(sheet, fmt.Sprintf("%s%d", excelColumnName(c), r+1), v)
+			}
+		}
+		if err := f.Write(&buf); err != nil {
+			return nil, err
+		}
+		_ = f.Close()
+	case "csv":
+		buf.WriteString("\uFEFF")
+		w := csv.NewWriter(&buf)
+		_ = w.WriteAll(d.table())
+		if err := w.Error(); err != nil {
+			return nil, err
+		}
+	case "md":
+		cell := strings.NewReplacer("|", "\\|", "\r\n", "<br>", "\n", "<br>").Replace
+		fmt.Fprintf(&buf, "# %s 数据字典\n\n", d.Title)
+		if d.Description != "" {
+			fmt.Fprintf(&buf, "%s\n\n", d.Description)
+		}
+		if d.Note != "" {
+			fmt.Fprintf(&buf, "%s\n\n", d.Note)
+		}
+		fmt.Fprintf(&buf, "| %s |\n|%s\n", strings.Join(d.Header, " | "), strings.Repeat(" --- |", len(d.Header)))
+		for _, row := range d.Rows {
+			cells := make([]string, len(row))
+			for i, v := range row {
+				cells[i] = cell(v)
+			}
+			fmt.Fprintf(&buf, "| %s |\n", strings.Join(cells, " | "))
+		}
+	case "html":
+		if err := dictionaryHTML.Execute(&buf, d); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("不支持的格式 %s", format)
+	}
+	return buf.Bytes(), nil
+}
+
+// table is the spreadsheet layout: the heading lines, a blank row, then the
+// header and one row per field.
+func (d *dictionaryDoc) table() [][]string {
+	rows := [][]string{{d.Title + " 数据字典"}}
+	for _, line := range []string{d.Description, d.Note} {
+		if line != "" {
+			rows = append(rows, []string{line})
+		}
+	}
+	rows = append(rows, []string{}, d.Header)
+	return append(rows, d.Rows...)
+}
+
+var dictionaryHTML = template.Must(template.New("dictionary").Parse(`<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}} 数据字典</title>
+<style>
+body { font-family: "Microsoft YaHei", "PingFang SC", sans-serif; font-size: 12px; margin: 24px; }
+h1 { font-size: 18px; }
+table { border-collapse: collapse; width: 100%; }
+th, td { border: 1px solid #999; padding: 4px 6px; text-align: left; vertical-align: top; }
+th { background: #eee; }
+tr { page-break-inside: avoid; }
+thead { display: table-header-group; }
+@page { size: A4 landscape; margin: 12mm; }
+</style>
+</head>
+<body>
+<h1>{{.Title}} 数据字典</h1>
+{{if .Description}}<p>{{.Description}}</p>
+{{end}}{{if .Note}}<p>{{.Note}}</p>
+{{end}}<table>
+<thead><tr>{{range .Header}}<th>{{.}}</th>{{end}}</tr></thead>
+<tbody>
+{{range .Rows}}<tr>{{range .}}<td>{{.}}</td>{{end}}</tr>
+{{end}}</tbody>
+</table>
+</body>
+</html>
+`))
+
+// Dictionary renders the table's current data dictionary, adding each field's
+// fill rate and basic statistics over the live rows (recycle bin excluded).
+func (s *Storage) Dictionary(ctx context.Context, table, format string) ([]byte, string, error) {
+	if err := s.CheckTable(ctx, table); err != nil {
+		return nil, "", err
+	}
+	schema, err := s.readSchema(ctx, s.db, table)
+	if err != nil {
+		return nil, "", err
+	}
+	stats, total, err := s.fieldStatistics(ctx, table, schema.Fields)
+	if err != nil {
+		return nil, "", err
+	}
+	doc := newDictionaryDoc(schema, fmt.Sprintf("共 %d 条记录（不含回收站），统计时间 %s", total, time.Now().Format("2006-01-02 15:04")))
+	doc.Header = append(doc.Header, "填写率", "统计")
+	for i, st := range stats {
+		fill := "-"
+		if total > 0 {
+			fill = fmt.Sprintf("%s%%（%d/%d）", strconv.FormatFloat(percent(st.filled, total), 'f', -1, 64), st.filled, total)
+		}
+		doc.Rows[i] = append(doc.Rows[i], fill, st.text())
+	}
+	data, err := doc.render(format)
+	if err != nil {
+		return nil, "", err
+	}
+	return data, schema.DisplayName, nil
+}
+
+// SchemaVersionDictionary renders the data dictionary of a table as it stood at
+// the given schema version, returning the file and that version's display name.
+func (s *Storage) SchemaVersionDictionary(ctx context.Context, table string, version int, format string) ([]byte, string, error) {
+	v, err := s.SchemaVersionAt(ctx, table, version)
+	if err != nil {
+		return nil, "", err
+	}
+	note := fmt.Sprintf("结构版本 %d（%s，%s %s）", v.Version, v.Action, v.Username, v.Time)
+	data, err := newDictionaryDoc(v.Schema, note).render(format)
+	if err != nil {
+		return nil, "", err
+	}
+	return data, v.Schema.DisplayName, nil
+}
+
+func isBoolHint(typeHint string) bool {
+	switch strings.ToLower(typeHint) {
+	case "boolean", "bool", "是/否":
+		return true
+	}
+	return false
+}
+
+// maxDistinct bounds the distinct-value count kept per field.
+const maxDistinct = 10000
+
+// fieldStats accumulates one field's values for the dictionary.
+type fieldStats struct {
+	def      FieldDefinition
+	filled   int
+	distinct map[string]bool
+	nums     sample
+	first    string
+	last     string
+	counts   map[string]int
+}
+
+func (s *Storage) fieldStatistics(ctx context.Context, table string, fields []FieldDefinition) ([]*fieldStats, int, error) {
+	stats := make([]*fieldStats, len(fields))
+	cols := make([]string, len(fields))
+	for i, f := range fields {
+		stats[i] = &fieldStats{def: f, distinct: map[string]bool{}, counts: map[string]int{}}
+		cols[i] = qualify(table, f.Name)
+	}
+	if len(fields) == 0 {
+		return stats, 0, nil
+	}
+	sc, err := s.scopeRows(ctx, table, QueryOptions{})
+	if err != nil {
+		return nil, 0, err
+	}
+	rows, err := s.db.QueryContext(ctx, sc.query(strings.Join(cols, ", "), ""), sc.params...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	total := 0
+	values := make([]any, len(fields))
+	dest := make([]any, len(fields))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return nil, 0, err
+		}
+		total++
+		for i, v := range values {
+			stats[i].add(v)
+		}
+	}
+	return stats, total, rows.Err()
+}
+
+func (st *fieldStats) add(v any) {
+	v = categoryValue(v)
+	if isBlank(v) {
+		return
+	}
+	st.filled++
+	key := fmt.Sprint(v)
+	if len(st.distinct) <= maxDistinct {
+		st.distinct[key] = true
+	}
+	hint := st.def.TypeHint
+	switch {
+	case isMultiHint(hint):
+		var codes []string
+		if err := json.Unmarshal([]byte(key), &codes); err != nil {
+			codes = []string{key}
+		}
+		for _, c := range codes {
+			st.counts[c]++
+		}
+	case isEnumHint(hint), isBoolHint(hint):
+		st.counts[key]++
+	case isNumericHint(hint):
+		st.nums.add(v)
+	case isDateHint(hint):
+		if st.first == "" || key < st.first {
+			st.first = key
+		}
+		if key > st.last {
+			st.last = key
+		}
+	}
+}
+
+// text summarises the field by type: option counts for choice and boolean
+// fields, mean/SD/median/range for numbers, the range of dates, and the number of
+// distinct values for text.
+func (st *fieldStats) text() string {
+	if st.filled == 0 {
+		return ""
+	}
+	hint := st.def.TypeHint
+	count := func(label string, n int) string {
+		return fmt.Sprintf("%s %d（%s%%）", label, n, strconv.FormatFloat(percent(n, st.filled), 'f', -1, 64))
+	}
+	switch {
+	case isChoiceHint(hint):
+		var parts []string
+		for _, o := range st.def.Options {
+			if n := st.counts[o.Code]; n > 0 {
+				parts = append(parts, count(ternary(o.Label != "", o.Label, o.Code), n))
+				delete(st.counts, o.Code)
+			}
+		}
+		for _, code := range slices.Sorted(maps.Keys(st.counts)) {
+			parts = append(parts, count(code+"（不在选项中）", st.counts[code]))
+		}
+		return strings.Join(parts, "；")
+	case isBoolHint(hint):
+		return count("是", st.counts["1"]) + "；" + count("否", st.counts["0"])
+	case isNumericHint(hint):
+		d := describe(&st.nums, nil)
+		num := func(key string) string { return strconv.FormatFloat(math.Round(d[key]*100)/100, 'f', -1, 64) }
+		var parts []string
+		if len(st.nums.nums) > 0 {
+			parts = append(parts, "均值 "+num("average"))
+			if _, ok := d["sd"]; ok {
+				parts = append(parts, "标准差 "+num("sd"))
+			}
+			parts = append(parts, "中位数 "+num("median"), fmt.Sprintf("范围 %s ~ %s", num("min"), num("max")))
+		}
+		if st.nums.nonNumeric > 0 {
+			parts = append(parts, fmt.Sprintf("非数值 %d 个", st.nums.nonNumeric))
+		}
+		return strings.Join(parts, "；")
+	case isDateHint(hint):
+		return fmt.Sprintf("范围 %s ~ %s", st.first, st.last)
+	}
+	if len(st.distinct) > maxDistinct {
+		return fmt.Sprintf("不同取值超过 %d 个", maxDistinct)
+	}
+	return fmt.Sprintf("不同取值 %d 个", len(st.distinct))
+}
@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"math"
+	"testing"
+)
+
+func near(t *testing.T, name string, got, want, tol float64) {
+	t.Helper()
+	if math.IsNaN(got) || math.Abs(got-want) > tol {
+		t.Errorf("%s = %.10g, want %.10g (±%g)", name, got, want, tol)
+	}
+}
+
+func TestStudentTCDF(t *testing.T) {
+	cases := []struct {
+		name  string
+		t, df float64
+		want  float64
+	}{
+		// df 1 is the Cauchy distribution and df 2 has a closed form.
+		{"cauchy 1", 1, 1, 0.5 + math.Atan(1)/math.Pi},
+		{"cauchy -3", -3, 1, 0.5 + math.Atan(-3)/math.Pi},
+		{"df2 1.5", 1.5, 2, 0.5 + 1.5/(2*math.Sqrt(2+1.5*1.5))},
+		{"df2 -0.4", -0.4, 2, 0.5 - 0.4/(2*math.Sqrt(2+0.4*0.4))},
+		{"pt(2, 5)", 2, 5, 0.9490302605850709},
+		{"zero", 0, 17, 0.5},
+	}
+	for _, c := range cases {
+		near(t, c.name, studentTCDF(c.t, c.df), c.want, 1e-9)
+	}
+}
+
+func TestStudentTQuantile(t *testing.T) {
+	cases := []struct {
+		p, df float64
+		want  float64
+	}{
+		{0.975, 1, math.Tan(math.Pi * 0.475)},
+		{0.975, 2, 0.95 / math.Sqrt(2*0.975*0.025)},
+		{0.975, 7, 2.364624251592785},
+		{0.975, 10, 2.228138851986274},
+		{0.975, 30, 2.042272456301238},
+		{0.995, 20, 2.845339709785564},
+	}
+	for _, c := range cases {
+		near(t, "qt", studentTQuantile(c.p, c.df), c.want, 1e-6)
+	}
+}
+
+func TestStudentTTwoSided(t *testing.T) {
+	near(t, "qt(0.975, 10)", studentTTwoSided(2.228138851986274, 10), 0.05, 1e-8)
+	near(t, "symmetric", studentTTwoSided(-2.228138851986274, 10), 0.05, 1e-8)
+	near(t, "zero", studentTTwoSided(0, 4), 1, 1e-12)
+}
+
+func TestChiSquareSF(t *testing.T) {
+	cases := []struct {
+		name  string
+		x, df float64
+		want  float64
+	}{
+		{"df1 critical", 3.841458820694124, 1, 0.05},
+		{"df2 critical", 5.991464547107979, 2, 0.05},
+		{"df10 critical", 18.307038053275146, 10, 0.05},
+		// df 1 is a squared normal, df 2 an exponential.
+		{"df1 closed form", 6.5, 1, math.Erfc(math.Sqrt(6.5 / 2))},
+		{"df2 closed form", 7.2, 2, math.Exp(-3.6)},
+		{"zero", 0, 3, 1},
+	}
+	for _, c := range cases {
+		near(t, c.name, chiSquareSF(c.x, c.df), c.want, 1e-9)
+	}
+}
+
+func TestFSF(t *testing.T) {
+	cases := []struct {
+		name        string
+		f, df1, df2 float64
+		want        float64
+	}{
+		// F(1, n) is the square of t with n degrees of freedom.
+		{"t squared", 2.228138851986274 * 2.228138851986274, 1, 10, 0.05},
+		// With df1 = 2 the tail is (1 + 2f/df2)^(-df2/2).
+		{"df1 2", 12, 2, 6, math.Pow(5, -3)},
+		{"df1 2 small", 0.7, 2, 15, math.Pow(1+2*0.7/15, -7.5)},
+		{"zero", 0, 3, 9, 1},
+	}
+	for _, c := range cases {
+		near(t, c.name, fSF(c.f, c.df1, c.df2), c.want, 1e-9)
+	}
+}
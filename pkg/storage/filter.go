@@ -0,0 +1,214 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+const (
+	maxFilterDepth = 8
+	maxFilterNodes = 200
+)
+
+// FilterNode is one node of the structured filter language accepted by Query and
+// the exports. A node is either a group ("and"/"or" with Children) or a condition
+// on Field. Values are converted with the column's TypeHint before binding, so
+// numeric comparisons compare numbers rather than text.
+//
+//	{"op":"and","children":[
+//	  {"op":"gt","field":"age","value":40},
+//	  {"op":"or","children":[
+//	    {"op":"in","field":"diagnosis","values":["VKH","BD"]},
+//	    {"op":"is_null","field":"iop"}]}]}
+type FilterNode struct {
+	Op       string       `json:"op"`
+	Field    string       `json:"field,omitempty"`
+	Value    any          `json:"value,omitempty"`
+	Values   []any        `json:"values,omitempty"`
+	Children []FilterNode `json:"children,omitempty"`
+}
+
+// FilterError marks malformed query input (filter tree, column list, page cursor)
+// so the API can answer 400 instead of 500.
+type FilterError struct {
+	Msg string
+}
+
+func (e *FilterError) Error() string {
+	return "查询条件错误: " + e.Msg
+}
+
+func filterErr(format string, args ...any) error {
+	return &FilterError{Msg: fmt.Sprintf(format, args...)}
+}
+
+type filterCompiler struct {
+	columns []string
+	defs    map[string]FieldDefinition
+	nodes   int
+	params  []any
+}
+
+func compileFilter(node *FilterNode, columns []string, defs map[string]FieldDefinition) (string, []any, error) {
+	fc := &filterCompiler{columns: columns, defs: defs}
+	clause, err := fc.compile(node, 0)
+	if err != nil {
+		return "", nil, err
+	}
+	return clause, fc.params, nil
+}
+
+func (fc *filterCompiler) compile(n *FilterNode, depth int) (string, error) {
+	fc.nodes++
+	if fc.nodes > maxFilterNodes {
+		return "", filterErr("条件过多（最多 %d 个）", maxFilterNodes)
+	}
+	if depth > maxFilterDepth {
+		return "", filterErr("嵌套层级过深（最多 %d 层）", maxFilterDepth)
+	}
+	op := strings.ToLower(strings.TrimSpace(n.Op))
+	if op == "and" || op == "or" {
+		if len(n.Children) == 0 {
+			return "", filterErr("%s 分组不能为空", op)
+		}
+		parts := make([]string, 0, len(n.Children))
+		for i := range n.Children {
+			part, err := fc.compile(&n.Children[i], depth+1)
+			if err != nil {
+				return "", err
+			}
+			parts = append(parts, part)
+		}
+		return "(" + strings.Join(parts, " "+strings.ToUpper(op)+" ") + ")", nil
+	}
+
+	if !slices.Contains(fc.columns, n.Field) && n.Field != "id" {
+		return "", filterErr("字段 %s 不存在", n.Field)
+	}
+	name := n.Field
+	def := fc.defs[name]
+	if name == "id" {
+		def = FieldDefinition{Name: "id", TypeHint: "integer"}
+	}
+	col := quoteIdent(name)
+
+	switch op {
+	case "eq", "ne", "gt", "gte", "lt", "lte":
+		v, err := fc.value(name, def, n.Value)
+		if err != nil {
+			return "", err
+		}
+		fc.params = append(fc.params, v)
+		return fmt.Sprintf("%s %s ?", col, comparisonOps[op]), nil
+	case "between":
+		if len(n.Values) != 2 {
+			return "", filterErr("between 需要两个值")
+		}
+		lo, err := fc.value(name, def, n.Values[0])
+		if err != nil {
+			return "", err
+		}
+		hi, err := fc.value(name, def, n.Values[1])
+		if err != nil {
+			return "", err
+		}
+		fc.params = append(fc.params, lo, hi)
+		return fmt.Sprintf("%s BETWEEN ? AND ?", col), nil
+	case "in", "not_in":
+		if len(n.Values) == 0 {
+			return "", filterErr("%s 需要至少一个值", op)
+		}
+		for _, raw := range n.Values {
+			v, err := fc.value(name, def, raw)
+			if err != nil {
+				return "", err
+			}
+			fc.params = append(fc.params, v)
+		}
+		return fmt.Sprintf("%s %s (%s)", col, ternary(op == "in", "IN", "NOT IN"), placeholders(len(n.Values))), nil
+	case "is_null":
+		return fmt.Sprintf("(%s IS NULL OR %s = '')", col, col), nil
+	case "not_null":
+		return fmt.Sprintf("(%s IS NOT NULL AND %s != '')", col, col), nil
+	case "starts_with", "contains":
+		text := strings.TrimSpace(fmt.Sprint(n.Value))
+		if n.Value == nil || text == "" {
+			return "", filterErr("%s 需要一个值", op)
+		}
+		pattern := escapeLike(text) + "%"
+		if op == "contains" {
+			pattern = "%" + pattern
+		}
+		fc.params = append(fc.params, pattern)
+		return fmt.Sprintf("%s LIKE ? ESCAPE '\\'", col), nil
+	case "has", "has_any", "has_all":
+		if !isMultiHint(def.TypeHint) {
+			return "", filterErr("%s 只能用于多选字段", op)
+		}
+		values := n.Values
+		if op == "has" {
+			values = []any{n.Value}
+		}
+		if len(values) == 0 || values[0] == nil {
+			return "", filterErr("%s 需要至少一个选项", op)
+		}
+		parts := make([]string, 0, len(values))
+		for _, raw := range values {
+			code, err := def.optionCode(raw)
+			if err != nil {
+				return "", filterErr("字段 %s: %v", name, err)
+			}
+			fc.params = append(fc.params, code)
+			parts = append(parts, fmt.Sprintf("EXISTS (SELECT 1 FROM json_each(CASE WHEN json_valid(%s) THEN %s END) WHERE value = ?)", col, col))
+		}
+		return "(" + strings.Join(parts, ternary(op == "has_all", " AND ", " OR ")) + ")", nil
+	default:
+		return "", filterErr("不支持的运算符 %s", n.Op)
+	}
+}
+
+var comparisonOps = map[string]string{
+	"eq":  "=",
+	"ne":  "!=",
+	"gt":  ">",
+	"gte": ">=",
+	"lt":  "<",
+	"lte": "<=",
+}
+
+// value converts a literal to the column's storage type; option labels become codes.
+func (fc *filterCompiler) value(col string, def FieldDefinition, raw any) (any, error) {
+	if raw == nil {
+		return nil, filterErr("字段 %s 缺少比较值", col)
+	}
+	v, err := convertField(def, raw)
+	if err != nil {
+		return nil, filterErr("字段 %s: %v", col, err)
+	}
+	if v == nil {
+		return nil, filterErr("字段 %s 缺少比较值", col)
+	}
+	if b, ok := v.(bool); ok {
+		return boolToInt(b), nil
+	}
+	return v, nil
+}
+
+func escapeLike(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return r.Replace(s)
+}
+
+func (s *Storage) columnDefs(ctx context.Context, table string) (map[string]FieldDefinition, error) {
+	fields, err := s.listColumns(ctx, table)
+	if err != nil {
+		return nil, err
+	}
+	defs := make(map[string]FieldDefinition, len(fields))
+	for _, f := range fields {
+		defs[f.Name] = f
+	}
+	return defs, nil
+}
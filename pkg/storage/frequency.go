@@ -0,0 +1,225 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Empty strings and NULL are both reported as a missing (null) category.
+
+type FrequencyItem struct {
+	Value        any     `json:"value"`
+	Count        int     `json:"count"`
+	Percent      float64 `json:"percent"`
+	ValidPercent float64 `json:"valid_percent"`
+}
+
+// FrequencyResult is a one-way frequency table. Percent is relative to all rows,
+// ValidPercent to the non-missing ones (the SPSS convention).
+type FrequencyResult struct {
+	Column  string          `json:"column"`
+	Total   int             `json:"total"`
+	Missing int             `json:"missing"`
+	Items   []FrequencyItem `json:"items"`
+}
+
+// CrosstabResult is a contingency table: Counts[i][j] is the number of rows with
+// RowValues[i] and ColValues[j]. A nil value is the missing category.
+type CrosstabResult struct {
+	Rows      string  `json:"rows"`
+	Cols      string  `json:"cols"`
+	RowValues []any   `json:"row_values"`
+	ColValues []any   `json:"col_values"`
+	Counts    [][]int `json:"counts"`
+	RowTotals []int   `json:"row_totals"`
+	ColTotals []int   `json:"col_totals"`
+	Total     int     `json:"total"`
+}
+
+func (s *Storage) categoryColumn(ctx context.Context, table, column string) error {
+	columns, err := s.tableColumns(ctx, table)
+	if err != nil {
+		return err
+	}
+	if slices.Contains(columns, column) {
+		return nil
+	}
+	return filterErr("字段 %s 不存在", column)
+}
+
+// Frequency counts each value of a column over the rows matching opts, most
+// frequent first with the missing category last.
+func (s *Storage) Frequency(ctx context.Context, table, column string, opts QueryOptions) (*FrequencyResult, error) {
+	if err := s.categoryColumn(ctx, table, column); err != nil {
+		return nil, err
+	}
+	sc, err := s.scopeRows(ctx, table, opts)
+	if err != nil {
+		return nil, err
+	}
+	key := categoryExpr(table, column)
+	query := sc.query(fmt.Sprintf("%s AS v, COUNT(1)", key), fmt.Sprintf("GROUP BY v ORDER BY v IS NULL, COUNT(1) DESC, v LIMIT %d", maxCategories+1))
+	rows, err := s.db.QueryContext(ctx, query, sc.params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	res := &FrequencyResult{Column: column, Items: []FrequencyItem{}}
+	for rows.Next() {
+		var item FrequencyItem
+		if err := rows.Scan(&item.Value, &item.Count); err != nil {
+			return nil, err
+		}
+		item.Value = categoryValue(item.Value)
+		res.Total += item.Count
+		if item.Value == nil {
+			res.Missing = item.Count
+		}
+		res.Items = append(res.Items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	distinct := len(res.Items)
+	if res.Missing > 0 {
+		distinct--
+	}
+	if distinct > maxCategories {
+		return nil, filterErr("字段 %s 的取值超过 %d 个", column, maxCategories)
+	}
+	valid := res.Total - res.Missing
+	for i := range res.Items {
+		res.Items[i].Percent = percent(res.Items[i].Count, res.Total)
+		if res.Items[i].Value != nil {
+			res.Items[i].ValidPercent = percent(res.Items[i].Count, valid)
+		}
+	}
+	return res, nil
+}
+
+// Crosstab builds the contingency table of two columns over the rows matching opts.
+func (s *Storage) Crosstab(ctx context.Context, table, rowCol, colCol string, opts QueryOptions) (*CrosstabResult, error) {
+	for _, col := range []string{rowCol, colCol} {
+		if err := s.categoryColumn(ctx, table, col); err != nil {
+			return nil, err
+		}
+	}
+	sc, err := s.scopeRows(ctx, table, opts)
+	if err != nil {
+		return nil, err
+	}
+	query := sc.query(fmt.Sprintf("%s AS r, %s AS c, COUNT(1)", categoryExpr(table, rowCol), categoryExpr(table, colCol)), "GROUP BY r, c")
+	rows, err := s.db.QueryContext(ctx, query, sc.params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	type cell struct {
+		r, c any
+		n    int
+	}
+	var cells []cell
+	rowIdx, colIdx := map[any]int{}, map[any]int{}
+	res := &CrosstabResult{Rows: rowCol, Cols: colCol, RowValues: []any{}, ColValues: []any{}}
+	for rows.Next() {
+		var cl cell
+		if err := rows.Scan(&cl.r, &cl.c, &cl.n); err != nil {
+			return nil, err
+		}
+		cl.r, cl.c = categoryValue(cl.r), categoryValue(cl.c)
+		if _, ok := rowIdx[cl.r]; !ok {
+			rowIdx[cl.r] = 0
+			res.RowValues = append(res.RowValues, cl.r)
+		}
+		if _, ok := colIdx[cl.c]; !ok {
+			colIdx[cl.c] = 0
+			res.ColValues = append(res.ColValues, cl.c)
+		}
+		if len(res.RowValues) > maxCategories || len(res.ColValues) > maxCategories {
+			return nil, filterErr("交叉表的行或列取值超过 %d 个", maxCategories)
+		}
+		cells = append(cells, cl)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	sortCategories(res.RowValues)
+	sortCategories(res.ColValues)
+	for i, v := range res.RowValues {
+		rowIdx[v] = i
+	}
+	for j, v := range res.ColValues {
+		colIdx[v] = j
+	}
+	res.Counts = make([][]int, len(res.RowValues))
+	for i := range res.Counts {
+		res.Counts[i] = make([]int, len(res.ColValues))
+	}
+	res.RowTotals = make([]int, len(res.RowValues))
+	res.ColTotals = make([]int, len(res.ColValues))
+	for _, cl := range cells {
+		i, j := rowIdx[cl.r], colIdx[cl.c]
+		res.Counts[i][j] += cl.n
+		res.RowTotals[i] += cl.n
+		res.ColTotals[j] += cl.n
+		res.Total += cl.n
+	}
+	return res, nil
+}
+
+// categoryExpr folds empty strings into NULL so both count as missing.
+func categoryExpr(table, column string) string {
+	return fmt.Sprintf("NULLIF(%s, '')", qualify(table, column))
+}
+
+func categoryValue(v any) any {
+	if b, ok := v.([]byte); ok {
+		return string(b)
+	}
+	return v
+}
+
+// sortCategories orders values the way SQLite does (numbers before text) but puts
+// the missing category last.
+func sortCategories(values []any) {
+	rank := func(v any) int {
+		switch v.(type) {
+		case nil:
+			return 2
+		case int64, float64:
+			return 0
+		default:
+			return 1
+		}
+	}
+	num := func(v any) float64 {
+		if i, ok := v.(int64); ok {
+			return float64(i)
+		}
+		return v.(float64)
+	}
+	sort.SliceStable(values, func(i, j int) bool {
+		a, b := values[i], values[j]
+		if ra, rb := rank(a), rank(b); ra != rb {
+			return ra < rb
+		}
+		switch rank(a) {
+		case 0:
+			return num(a) < num(b)
+		case 1:
+			return strings.Compare(fmt.Sprint(a), fmt.Sprint(b)) < 0
+		}
+		return false
+	})
+}
+
+func percent(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return math.Round(float64(n)*10000/float64(total)) / 100
+}
@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"go.uber.org/zap"
+)
+
+const (
+	PermRead  = "read"
+	PermWrite = "write"
+)
+
+// TableGrant gives a non-admin user read or write access to one table.
+// Schema changes (create/alter/clear/drop) stay admin-only.
+type TableGrant struct {
+	TableName  string `json:"table_name"`
+	UserID     int64  `json:"user_id"`
+	Username   string `json:"username,omitempty"`
+	Permission string `json:"permission"`
+}
+
+func (s *Storage) ensureGrants() error {
+	_, err := s.db.Exec(`CREATE TABLE IF NOT EXISTS table_grants (
+		table_name TEXT NOT NULL,
+		user_id INTEGER NOT NULL,
+		permission TEXT NOT NULL,
+		PRIMARY KEY (table_name, user_id)
+	);`)
+	return err
+}
+
+func (s *Storage) ListGrants(ctx context.Context, table string) ([]TableGrant, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT g.table_name, g.user_id, COALESCE(u.username,''), g.permission
+		FROM table_grants g LEFT JOIN users u ON u.id=g.user_id
+		WHERE g.table_name=? ORDER BY g.user_id`, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var grants []TableGrant
+	for rows.Next() {
+		var g TableGrant
+		if err := rows.Scan(&g.TableName, &g.UserID, &g.Username, &g.Permission); err != nil {
+			return nil, err
+		}
+		grants = append(grants, g)
+	}
+	return grants, rows.Err()
+}
+
+// SetGrants replaces every grant on the table with the given list.
+func (s *Storage) SetGrants(ctx context.Context, table string, grants []TableGrant) error {
+	for _, g := range grants {
+		if g.Permission != PermRead && g.Permission != PermWrite {
+			return fmt.Errorf("未知权限 %s", g.Permission)
+		}
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, `DELETE FROM table_grants WHERE table_name=?`, table); err != nil {
+		return err
+	}
+	for _, g := range grants {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO table_grants(table_name, user_id, permission) VALUES(?,?,?)
+			ON CONFLICT(table_name, user_id) DO UPDATE SET permission=excluded.permission`,
+			table, g.UserID, g.Permission); err != nil {
+			s.l.Error("insert grant failed", zap.String("table", table), zap.Int64("user", g.UserID), zap.Error(err))
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// TablePermission returns the effective permission of the user on the table,
+// or "" when the user has no access. Analysts are capped at read.
+func (s *Storage) TablePermission(ctx context.Context, u *User, table string) (string, error) {
+	if u == nil {
+		return "", nil
+	}
+	if u.IsAdmin() {
+		return PermWrite, nil
+	}
+	var perm string
+	err := s.db.QueryRowContext(ctx, `SELECT permission FROM table_grants WHERE table_name=? AND user_id=?`, table, u.ID).Scan(&perm)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if u.Role == RoleAnalyst {
+		return PermRead, nil
+	}
+	return perm, nil
+}
+
+// Allows reports whether the granted permission covers the required one.
+func Allows(granted, required string) bool {
+	switch required {
+	case PermRead:
+		return granted == PermRead || granted == PermWrite
+	case PermWrite:
+		return granted == PermWrite
+	}
+	return false
+}
@@ -0,0 +1,235 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"go.uber.org/zap"
+)
+
+type RowVersion struct {
+	Version  int            `json:"version"`
+	Action   string         `json:"action"`
+	Username string         `json:"username"`
+	Time     string         `json:"time"`
+	Data     map[string]any `json:"data"`
+}
+
+type FieldChange struct {
+	Field string `json:"field"`
+	From  any    `json:"from"`
+	To    any    `json:"to"`
+}
+
+// Each insert/update/delete stores a full snapshot of the row so any version can be
+// viewed or restored. Snapshots keep the column names in use at the time of the write.
+func (s *Storage) ensureHistory() error {
+	ddl := []string{
+		`CREATE TABLE IF NOT EXISTS row_versions (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			table_name TEXT NOT NULL,
+			row_id INTEGER NOT NULL,
+			version INTEGER NOT NULL,
+			action TEXT NOT NULL,
+			user_id INTEGER,
+			username TEXT,
+			ts DATETIME DEFAULT CURRENT_TIMESTAMP,
+			data_json TEXT
+		);`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_row_versions ON row_versions(table_name, row_id, version);`,
+	}
+	for _, stmt := range ddl {
+		if _, err := s.db.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Storage) recordVersion(ctx context.Context, q execer, action, table string, rowID int64, data map[string]any) error {
+	a := actorFrom(ctx)
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if _, err := q.ExecContext(ctx, `INSERT INTO row_versions(table_name, row_id, version, action, user_id, username, data_json)
+		VALUES(?, ?, (SELECT COALESCE(MAX(version),0)+1 FROM row_versions WHERE table_name=? AND row_id=?), ?, ?, ?, ?)`,
+		table, rowID, table, rowID, action, a.UserID, a.Username, string(raw)); err != nil {
+		s.l.Error("record row version failed", zap.String("table", table), zap.Int64("row", rowID), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (s *Storage) recordVersions(ctx context.Context, q execer, action, table string, rows []map[string]any) error {
+	for _, r := range rows {
+		id, _ := r["id"].(int64)
+		if err := s.recordVersion(ctx, q, action, table, id, r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RowHistory lists all versions of a row, oldest first. When at is set, only the
+// version in effect at that time is returned.
+func (s *Storage) RowHistory(ctx context.Context, table string, id int64, at string) ([]RowVersion, error) {
+	query := `SELECT version, action, COALESCE(username,''), strftime('%Y-%m-%d %H:%M:%S', ts), data_json
+		FROM row_versions WHERE table_name=? AND row_id=?`
+	args := []any{table, id}
+	if at != "" {
+		ts, err := auditTime(at, true)
+		if err != nil {
+			return nil, err
+		}
+		query += ` AND ts<=? ORDER BY version DESC LIMIT 1`
+		args = append(args, ts)
+	} else {
+		query += ` ORDER BY version`
+	}
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var versions []RowVersion
+	for rows.Next() {
+		var v RowVersion
+		var raw string
+		if err := rows.Scan(&v.Version, &v.Action, &v.Username, &v.Time, &raw); err != nil {
+			return nil, err
+		}
+		_ = json.Unmarshal([]byte(raw), &v.Data)
+		versions = append(versions, v)
+	}
+	return versions, rows.Err()
+}
+
+func (s *Storage) RowVersionAt(ctx context.Context, table string, id int64, version int) (*RowVersion, error) {
+	var v RowVersion
+	var raw string
+	err := s.db.QueryRowContext(ctx, `SELECT version, action, COALESCE(username,''), strftime('%Y-%m-%d %H:%M:%S', ts), data_json
+		FROM row_versions WHERE table_name=? AND row_id=? AND version=?`, table, id, version).
+		Scan(&v.Version, &v.Action, &v.Username, &v.Time, &raw)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("记录 %d 不存在版本 %d", id, version)
+	}
+	if err != nil {
+		return nil, err
+	}
+	_ = json.Unmarshal([]byte(raw), &v.Data)
+	return &v, nil
+}
+
+// DiffRowVersions compares two snapshots field by field, ignoring bookkeeping columns.
+func (s *Storage) DiffRowVersions(ctx context.Context, table string, id int64, from, to int) ([]FieldChange, error) {
+	a, err := s.RowVersionAt(ctx, table, id, from)
+	if err != nil {
+		return nil, err
+	}
+	b, err := s.RowVersionAt(ctx, table, id, to)
+	if err != nil {
+		return nil, err
+	}
+	keys := map[string]bool{}
+	for k := range a.Data {
+		keys[k] = true
+	}
+	for k := range b.Data {
+		keys[k] = true
+	}
+	var names []string
+	for k := range keys {
+		if isSystemColumn(k) {
+			continue
+		}
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	changes := []FieldChange{}
+	for _, k := range names {
+		if !reflect.DeepEqual(a.Data[k], b.Data[k]) {
+			changes = append(changes, FieldChange{Field: k, From: a.Data[k], To: b.Data[k]})
+		}
+	}
+	return changes, nil
+}
+
+// RevertRow writes the values of an earlier version back through UpdateRow, which
+// validates them against the current schema and records a new version. Only the
+// columns present in the snapshot are written.
+func (s *Storage) RevertRow(ctx context.Context, table string, id int64, version int) error {
+	v, err := s.RowVersionAt(ctx, table, id, version)
+	if err != nil {
+		return err
+	}
+	columns, err := s.tableColumns(ctx, table)
+	if err != nil {
+		return err
+	}
+	// Columns added after the snapshot are left as they are.
+	data := map[string]any{}
+	for _, col := range columns {
+		if val, ok := v.Data[col]; ok {
+			data[col] = val
+		}
+	}
+	return s.UpdateRow(ctx, table, id, data)
+}
+
+// renameVersionColumns rewrites the snapshot keys of renamed columns (old name to
+// new name) so history and revert keep working after a column rename.
+func renameVersionColumns(ctx context.Context, q execer, table string, renames map[string]string) error {
+	if len(renames) == 0 {
+		return nil
+	}
+	rows, err := q.QueryContext(ctx, `SELECT id, data_json FROM row_versions WHERE table_name=?`, table)
+	if err != nil {
+		return err
+	}
+	updates := map[int64]string{}
+	for rows.Next() {
+		var id int64
+		var raw string
+		if err := rows.Scan(&id, &raw); err != nil {
+			rows.Close()
+			return err
+		}
+		var data map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(raw), &data); err != nil {
+			continue
+		}
+		renamed := make(map[string]json.RawMessage, len(data))
+		changed := false
+		for k, val := range data {
+			if to, ok := renames[k]; ok {
+				k, changed = to, true
+			}
+			renamed[k] = val
+		}
+		if !changed {
+			continue
+		}
+		out, err := json.Marshal(renamed)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		updates[id] = string(out)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for id, raw := range updates {
+		if _, err := q.ExecContext(ctx, `UPDATE row_versions SET data_json=? WHERE id=?`, raw, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
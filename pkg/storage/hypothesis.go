@@ -0,0 +1,475 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+)
+
+const (
+	TestStudent     = "t_test"
+	TestWelch       = "welch"
+	TestMannWhitney = "mann_whitney"
+	TestChiSquare   = "chi_square"
+	TestFisher      = "fisher"
+	TestANOVA       = "anova"
+	TestKruskal     = "kruskal"
+)
+
+// TestRequest selects a test. Numeric tests compare Column across the values of
+// GroupBy (optionally only the listed Groups); chi-square and Fisher test the
+// crosstab of Rows and Cols. Rows with a missing group or value are left out.
+type TestRequest struct {
+	Test    string   `json:"test"`
+	Column  string   `json:"column"`
+	GroupBy string   `json:"group_by"`
+	Groups  []string `json:"groups"`
+	Rows    string   `json:"rows"`
+	Cols    string   `json:"cols"`
+}
+
+type TestGroup struct {
+	Value  any     `json:"value"`
+	N      int     `json:"n"`
+	Mean   float64 `json:"mean"`
+	SD     float64 `json:"sd"`
+	Median float64 `json:"median"`
+}
+
+// TestResult always reports a two-sided p-value.
+type TestResult struct {
+	Test       string          `json:"test"`
+	Statistic  float64         `json:"statistic"`
+	DF         float64         `json:"df,omitempty"`
+	DF2        float64         `json:"df2,omitempty"`
+	PValue     float64         `json:"p_value"`
+	EffectSize float64         `json:"effect_size"`
+	Effect     string          `json:"effect"`
+	Groups     []TestGroup     `json:"groups,omitempty"`
+	Crosstab   *CrosstabResult `json:"crosstab,omitempty"`
+	Notes      []string        `json:"notes,omitempty"`
+}
+
+func (s *Storage) HypothesisTest(ctx context.Context, table string, req TestRequest, opts QueryOptions) (*TestResult, error) {
+	switch req.Test {
+	case TestChiSquare, TestFisher:
+		ct, err := s.completeCrosstab(ctx, table, req.Rows, req.Cols, opts)
+		if err != nil {
+			return nil, err
+		}
+		if req.Test == TestFisher {
+			return fisherExact(ct)
+		}
+		return chiSquareTest(ct)
+	case TestStudent, TestWelch, TestMannWhitney, TestANOVA, TestKruskal:
+		values, samples, err := s.groupSamples(ctx, table, req, opts)
+		if err != nil {
+			return nil, err
+		}
+		two := req.Test == TestStudent || req.Test == TestWelch || req.Test == TestMannWhitney
+		if two && len(samples) != 2 {
+			return nil, inputErr("该检验需要恰好两个组，当前 %d 个（可用 groups 指定）", len(samples))
+		}
+		if len(samples) < 2 {
+			return nil, inputErr("至少需要两个组")
+		}
+		var res *TestResult
+		switch req.Test {
+		case TestStudent, TestWelch:
+			res, err = tTest(samples[0], samples[1], req.Test == TestWelch)
+		case TestMannWhitney:
+			res, err = mannWhitney(samples[0], samples[1])
+		case TestANOVA:
+			res, err = oneWayANOVA(samples)
+		case TestKruskal:
+			res, err = kruskalWallis(samples)
+		}
+		if err != nil {
+			return nil, err
+		}
+		for i, v := range values {
+			res.Groups = append(res.Groups, describeGroup(v, samples[i]))
+		}
+		return res, nil
+	default:
+		return nil, inputErr("不支持的检验 %s", req.Test)
+	}
+}
+
+// groupSamples reads Column split by GroupBy, in the order of req.Groups when given.
+func (s *Storage) groupSamples(ctx context.Context, table string, req TestRequest, opts QueryOptions) ([]any, [][]float64, error) {
+	defs, err := s.columnDefs(ctx, table)
+	if err != nil {
+		return nil, nil, err
+	}
+	if def, ok := defs[req.Column]; !ok || !isNumericHint(def.TypeHint) {
+		return nil, nil, inputErr("字段 %s 不存在或不是数值类型", req.Column)
+	}
+	if _, ok := defs[req.GroupBy]; !ok {
+		return nil, nil, inputErr("分组字段 %s 不存在", req.GroupBy)
+	}
+	sc, err := s.scopeRows(ctx, table, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	query := sc.query(qualify(table, req.Column)+", "+categoryExpr(table, req.GroupBy), "")
+	rows, err := s.db.QueryContext(ctx, query, sc.params...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	byGroup := map[any]*sample{}
+	var values []any
+	for rows.Next() {
+		var v, g any
+		if err := rows.Scan(&v, &g); err != nil {
+			return nil, nil, err
+		}
+		g = categoryValue(g)
+		if g == nil {
+			continue
+		}
+		if len(req.Groups) > 0 && !slices.Contains(req.Groups, fmt.Sprint(g)) {
+			continue
+		}
+		sm, ok := byGroup[g]
+		if !ok {
+			if len(byGroup) == maxCategories {
+				return nil, nil, inputErr("分组字段 %s 的取值超过 %d 个", req.GroupBy, maxCategories)
+			}
+			sm = &sample{}
+			byGroup[g] = sm
+			values = append(values, g)
+		}
+		sm.add(v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	if len(req.Groups) > 0 {
+		sort.SliceStable(values, func(i, j int) bool {
+			return slices.Index(req.Groups, fmt.Sprint(values[i])) < slices.Index(req.Groups, fmt.Sprint(values[j]))
+		})
+	} else {
+		sortCategories(values)
+	}
+	samples := make([][]float64, 0, len(values))
+	for _, v := range values {
+		samples = append(samples, byGroup[v].nums)
+	}
+	return values, samples, nil
+}
+
+// completeCrosstab is Crosstab without the missing categories.
+func (s *Storage) completeCrosstab(ctx context.Context, table, rowCol, colCol string, opts QueryOptions) (*CrosstabResult, error) {
+	if rowCol == "" || colCol == "" {
+		return nil, inputErr("需要指定行字段和列字段")
+	}
+	ct, err := s.Crosstab(ctx, table, rowCol, colCol, opts)
+	if err != nil {
+		return nil, err
+	}
+	missingRow := slices.IndexFunc(ct.RowValues, func(v any) bool { return v == nil })
+	missingCol := slices.IndexFunc(ct.ColValues, func(v any) bool { return v == nil })
+	if missingRow < 0 && missingCol < 0 {
+		return ct, nil
+	}
+	// The missing category is always sorted last, so trimming the tail drops it.
+	nr, nc := len(ct.RowValues), len(ct.ColValues)
+	if missingRow >= 0 {
+		nr = missingRow
+	}
+	if missingCol >= 0 {
+		nc = missingCol
+	}
+	out := &CrosstabResult{Rows: ct.Rows, Cols: ct.Cols, RowValues: ct.RowValues[:nr], ColValues: ct.ColValues[:nc],
+		Counts: make([][]int, nr), RowTotals: make([]int, nr), ColTotals: make([]int, nc)}
+	for i := 0; i < nr; i++ {
+		out.Counts[i] = ct.Counts[i][:nc]
+		for j := 0; j < nc; j++ {
+			out.RowTotals[i] += out.Counts[i][j]
+			out.ColTotals[j] += out.Counts[i][j]
+			out.Total += out.Counts[i][j]
+		}
+	}
+	return out, nil
+}
+
+func describeGroup(value any, nums []float64) TestGroup {
+	g := TestGroup{Value: value, N: len(nums)}
+	if len(nums) == 0 {
+		return g
+	}
+	g.Mean, g.SD = meanSD(nums)
+	sorted := slices.Clone(nums)
+	slices.Sort(sorted)
+	g.Median = quantile(sorted, 0.5)
+	return g
+}
+
+// meanSD returns the mean and the sample standard deviation (0 for n < 2).
+func meanSD(nums []float64) (float64, float64) {
+	var sum float64
+	for _, x := range nums {
+		sum += x
+	}
+	mean := sum / float64(len(nums))
+	if len(nums) < 2 {
+		return mean, 0
+	}
+	var ss float64
+	for _, x := range nums {
+		ss += (x - mean) * (x - mean)
+	}
+	return mean, math.Sqrt(ss / float64(len(nums)-1))
+}
+
+// tTest is Student's (pooled variance) or Welch's t-test; the effect size is
+// Cohen's d with the pooled SD in both cases.
+func tTest(a, b []float64, welch bool) (*TestResult, error) {
+	n1, n2 := float64(len(a)), float64(len(b))
+	if n1 < 2 || n2 < 2 {
+		return nil, inputErr("每组至少需要 2 个数值")
+	}
+	m1, s1 := meanSD(a)
+	m2, s2 := meanSD(b)
+	v1, v2 := s1*s1, s2*s2
+	pooled := math.Sqrt(((n1-1)*v1 + (n2-1)*v2) / (n1 + n2 - 2))
+	if pooled == 0 {
+		return nil, inputErr("两组数值均无变异，无法检验")
+	}
+	res := &TestResult{Test: TestStudent, Effect: "cohen_d", EffectSize: (m1 - m2) / pooled}
+	if welch {
+		se2 := v1/n1 + v2/n2
+		res.Test = TestWelch
+		res.Statistic = (m1 - m2) / math.Sqrt(se2)
+		res.DF = se2 * se2 / (v1*v1/(n1*n1*(n1-1)) + v2*v2/(n2*n2*(n2-1)))
+	} else {
+		res.Statistic = (m1 - m2) / (pooled * math.Sqrt(1/n1+1/n2))
+		res.DF = n1 + n2 - 2
+	}
+	res.PValue = studentTTwoSided(res.Statistic, res.DF)
+	return res, nil
+}
+
+// rank assigns average ranks (1-based) to the pooled values and returns the tie
+// correction term sum(t^3 - t).
+func rank(values []float64) ([]float64, float64) {
+	idx := make([]int, len(values))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.Slice(idx, func(i, j int) bool { return values[idx[i]] < values[idx[j]] })
+	ranks := make([]float64, len(values))
+	var ties float64
+	for i := 0; i < len(idx); {
+		j := i
+		for j+1 < len(idx) && values[idx[j+1]] == values[idx[i]] {
+			j++
+		}
+		avg := float64(i+j)/2 + 1
+		for k := i; k <= j; k++ {
+			ranks[idx[k]] = avg
+		}
+		t := float64(j - i + 1)
+		ties += t*t*t - t
+		i = j + 1
+	}
+	return ranks, ties
+}
+
+// mannWhitney reports U of the first group with the normal approximation (tie and
+// continuity corrected); the effect size is the rank-biserial correlation.
+func mannWhitney(a, b []float64) (*TestResult, error) {
+	n1, n2 := float64(len(a)), float64(len(b))
+	if n1 == 0 || n2 == 0 {
+		return nil, inputErr("每组至少需要 1 个数值")
+	}
+	ranks, ties := rank(append(slices.Clone(a), b...))
+	var r1 float64
+	for i := range a {
+		r1 += ranks[i]
+	}
+	u := r1 - n1*(n1+1)/2
+	n := n1 + n2
+	mu := n1 * n2 / 2
+	sigma := math.Sqrt(n1 * n2 / 12 * ((n + 1) - ties/(n*(n-1))))
+	if sigma == 0 {
+		return nil, inputErr("所有数值相同，无法检验")
+	}
+	z := (math.Abs(u-mu) - 0.5) / sigma
+	if z < 0 {
+		z = 0
+	}
+	res := &TestResult{
+		Test:       TestMannWhitney,
+		Statistic:  u,
+		PValue:     math.Min(1, 2*(1-normalCDF(z))),
+		Effect:     "rank_biserial",
+		EffectSize: 2*u/(n1*n2) - 1,
+	}
+	if n1 < 10 || n2 < 10 {
+		res.Notes = append(res.Notes, "样本量较小，p 值为正态近似")
+	}
+	return res, nil
+}
+
+// oneWayANOVA reports F with eta squared as the effect size.
+func oneWayANOVA(groups [][]float64) (*TestResult, error) {
+	var n, grand float64
+	for _, g := range groups {
+		for _, x := range g {
+			grand += x
+		}
+		n += float64(len(g))
+	}
+	k := float64(len(groups))
+	if n <= k {
+		return nil, inputErr("数值个数需多于组数")
+	}
+	grand /= n
+	var ssb, ssw float64
+	for _, g := range groups {
+		if len(g) == 0 {
+			return nil, inputErr("存在没有数值的组")
+		}
+		m, _ := meanSD(g)
+		ssb += float64(len(g)) * (m - grand) * (m - grand)
+		for _, x := range g {
+			ssw += (x - m) * (x - m)
+		}
+	}
+	if ssw == 0 {
+		return nil, inputErr("组内无变异，无法检验")
+	}
+	df1, df2 := k-1, n-k
+	f := (ssb / df1) / (ssw / df2)
+	return &TestResult{
+		Test:       TestANOVA,
+		Statistic:  f,
+		DF:         df1,
+		DF2:        df2,
+		PValue:     fSF(f, df1, df2),
+		Effect:     "eta_squared",
+		EffectSize: ssb / (ssb + ssw),
+	}, nil
+}
+
+// kruskalWallis reports the tie-corrected H with epsilon squared as the effect size.
+func kruskalWallis(groups [][]float64) (*TestResult, error) {
+	var pooled []float64
+	for _, g := range groups {
+		if len(g) == 0 {
+			return nil, inputErr("存在没有数值的组")
+		}
+		pooled = append(pooled, g...)
+	}
+	ranks, ties := rank(pooled)
+	n := float64(len(pooled))
+	var h float64
+	offset := 0
+	for _, g := range groups {
+		var r float64
+		for i := range g {
+			r += ranks[offset+i]
+		}
+		offset += len(g)
+		h += r * r / float64(len(g))
+	}
+	h = 12/(n*(n+1))*h - 3*(n+1)
+	correction := 1 - ties/(n*n*n-n)
+	if correction == 0 {
+		return nil, inputErr("所有数值相同，无法检验")
+	}
+	h /= correction
+	df := float64(len(groups) - 1)
+	return &TestResult{
+		Test:       TestKruskal,
+		Statistic:  h,
+		DF:         df,
+		PValue:     chiSquareSF(h, df),
+		Effect:     "epsilon_squared",
+		EffectSize: h / (n - 1),
+	}, nil
+}
+
+// chiSquareTest is Pearson's chi-square without continuity correction; the effect
+// size is Cramér's V.
+func chiSquareTest(ct *CrosstabResult) (*TestResult, error) {
+	r, c := len(ct.RowValues), len(ct.ColValues)
+	if r < 2 || c < 2 || ct.Total == 0 {
+		return nil, inputErr("交叉表至少需要 2 行 2 列")
+	}
+	var x2 float64
+	small := 0
+	for i := 0; i < r; i++ {
+		for j := 0; j < c; j++ {
+			e := float64(ct.RowTotals[i]) * float64(ct.ColTotals[j]) / float64(ct.Total)
+			if e == 0 {
+				return nil, inputErr("存在合计为 0 的行或列，无法检验")
+			}
+			if e < 5 {
+				small++
+			}
+			d := float64(ct.Counts[i][j]) - e
+			x2 += d * d / e
+		}
+	}
+	df := float64((r - 1) * (c - 1))
+	res := &TestResult{
+		Test:       TestChiSquare,
+		Statistic:  x2,
+		DF:         df,
+		PValue:     chiSquareSF(x2, df),
+		Effect:     "cramers_v",
+		EffectSize: math.Sqrt(x2 / (float64(ct.Total) * float64(min(r, c)-1))),
+		Crosstab:   ct,
+	}
+	if float64(small) > 0.2*float64(r*c) {
+		res.Notes = append(res.Notes, "超过 20% 的期望频数小于 5，建议使用 Fisher 精确检验")
+	}
+	return res, nil
+}
+
+// fisherExact is the two-sided Fisher exact test on a 2x2 table, summing every
+// table with the same margins that is no more likely than the observed one. The
+// effect size is the odds ratio (Haldane-corrected when a cell is zero).
+func fisherExact(ct *CrosstabResult) (*TestResult, error) {
+	if len(ct.RowValues) != 2 || len(ct.ColValues) != 2 {
+		return nil, inputErr("Fisher 精确检验需要 2×2 表，当前 %d×%d", len(ct.RowValues), len(ct.ColValues))
+	}
+	a, b := ct.Counts[0][0], ct.Counts[0][1]
+	c, d := ct.Counts[1][0], ct.Counts[1][1]
+	r1, c1, n := a+b, a+c, a+b+c+d
+	if n == 0 {
+		return nil, inputErr("没有数据")
+	}
+	logp := func(x int) float64 {
+		return lchoose(c1, x) + lchoose(n-c1, r1-x) - lchoose(n, r1)
+	}
+	observed := logp(a)
+	var p float64
+	for x := max(0, r1+c1-n); x <= min(r1, c1); x++ {
+		if lp := logp(x); lp <= observed+1e-7 {
+			p += math.Exp(lp)
+		}
+	}
+	res := &TestResult{Test: TestFisher, PValue: math.Min(1, p), Effect: "odds_ratio", Crosstab: ct}
+	fa, fb, fc, fd := float64(a), float64(b), float64(c), float64(d)
+	if a == 0 || b == 0 || c == 0 || d == 0 {
+		fa, fb, fc, fd = fa+0.5, fb+0.5, fc+0.5, fd+0.5
+		res.Notes = append(res.Notes, "存在 0 频数，比值比已加 0.5 校正")
+	}
+	res.EffectSize = fa * fd / (fb * fc)
+	res.Statistic = res.EffectSize
+	return res, nil
+}
+
+func lchoose(n, k int) float64 {
+	a, _ := math.Lgamma(float64(n + 1))
+	b, _ := math.Lgamma(float64(k + 1))
+	c, _ := math.Lgamma(float64(n - k + 1))
+	return a - b - c
+}
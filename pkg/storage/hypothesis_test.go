@@ -0,0 +1,152 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+)
+
+// crosstab builds a table with its margins from the counts alone.
+func crosstab(counts [][]int) *CrosstabResult {
+	ct := &CrosstabResult{Counts: counts, RowTotals: make([]int, len(counts)), ColTotals: make([]int, len(counts[0]))}
+	for i, row := range counts {
+		ct.RowValues = append(ct.RowValues, i)
+		for j, n := range row {
+			ct.RowTotals[i] += n
+			ct.ColTotals[j] += n
+			ct.Total += n
+		}
+	}
+	for j := range counts[0] {
+		ct.ColValues = append(ct.ColValues, j)
+	}
+	return ct
+}
+
+func TestTTest(t *testing.T) {
+	a := []float64{1, 2, 3, 4, 5}
+	b := []float64{2, 4, 6, 8, 10}
+	// R: t.test(a, b, var.equal = TRUE) and t.test(a, b).
+	cases := []struct {
+		welch     bool
+		statistic float64
+		df        float64
+		p         float64
+	}{
+		{false, -1.8973665961010275, 8, 0.09434977},
+		{true, -1.8973665961010275, 5.882352941176471, 0.10753119},
+	}
+	for _, c := range cases {
+		res, err := tTest(a, b, c.welch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		near(t, res.Test+" t", res.Statistic, c.statistic, 1e-9)
+		near(t, res.Test+" df", res.DF, c.df, 1e-9)
+		near(t, res.Test+" p", res.PValue, c.p, 1e-6)
+		near(t, res.Test+" d", res.EffectSize, -1.2, 1e-9)
+	}
+}
+
+func TestMannWhitneyU(t *testing.T) {
+	// R: wilcox.test(a, b, exact = FALSE) with the continuity correction.
+	res, err := mannWhitney([]float64{1, 2, 3}, []float64{4, 5, 6})
+	if err != nil {
+		t.Fatal(err)
+	}
+	near(t, "U", res.Statistic, 0, 0)
+	near(t, "p", res.PValue, 0.0808555983700523, 1e-9)
+	near(t, "rank biserial", res.EffectSize, -1, 1e-12)
+}
+
+func TestOneWayANOVA(t *testing.T) {
+	// SSB = 54 on 2 df, SSW = 6 on 6 df; with df1 = 2 the p-value is (1+2F/6)^-3.
+	res, err := oneWayANOVA([][]float64{{1, 2, 3}, {4, 5, 6}, {7, 8, 9}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	near(t, "F", res.Statistic, 27, 1e-9)
+	near(t, "df1", res.DF, 2, 0)
+	near(t, "df2", res.DF2, 6, 0)
+	near(t, "p", res.PValue, 0.001, 1e-9)
+	near(t, "eta squared", res.EffectSize, 0.9, 1e-12)
+}
+
+func TestKruskalWallis(t *testing.T) {
+	cases := []struct {
+		name   string
+		groups [][]float64
+		h, p   float64
+	}{
+		{"no ties", [][]float64{{1, 2, 3}, {4, 5, 6}, {7, 8, 9}}, 7.2, 0.02732372244729256},
+		{"ties", [][]float64{{1, 2, 2}, {3, 3, 4}}, 4.090909090909091, 0.043114446783075355},
+	}
+	for _, c := range cases {
+		res, err := kruskalWallis(c.groups)
+		if err != nil {
+			t.Fatal(err)
+		}
+		near(t, c.name+" H", res.Statistic, c.h, 1e-9)
+		near(t, c.name+" p", res.PValue, c.p, 1e-9)
+	}
+}
+
+func TestChiSquareTest(t *testing.T) {
+	cases := []struct {
+		name   string
+		counts [][]int
+		x2, df float64
+		p, v   float64
+	}{
+		{"2x2", [][]int{{10, 20}, {20, 10}}, 20.0 / 3, 1, 0.009823274507519245, 1.0 / 3},
+		{"2x3", [][]int{{10, 20, 30}, {30, 20, 10}}, 20, 2, 4.5399929762484854e-05, 0.408248290463863},
+	}
+	for _, c := range cases {
+		res, err := chiSquareTest(crosstab(c.counts))
+		if err != nil {
+			t.Fatal(err)
+		}
+		near(t, c.name+" X2", res.Statistic, c.x2, 1e-9)
+		near(t, c.name+" df", res.DF, c.df, 0)
+		near(t, c.name+" p", res.PValue, c.p, 1e-9)
+		near(t, c.name+" V", res.EffectSize, c.v, 1e-9)
+	}
+}
+
+func TestFisherExact(t *testing.T) {
+	// R: fisher.test(); the odds ratio here is the sample one.
+	cases := []struct {
+		name   string
+		counts [][]int
+		p      float64
+		or     float64
+	}{
+		{"tea tasting", [][]int{{3, 1}, {1, 3}}, 17.0 / 35, 9},
+		{"dieting", [][]int{{1, 9}, {11, 3}}, 0.002759456, 3.0 / 99},
+		{"no association", [][]int{{5, 5}, {5, 5}}, 1, 1},
+	}
+	for _, c := range cases {
+		res, err := fisherExact(crosstab(c.counts))
+		if err != nil {
+			t.Fatal(err)
+		}
+		near(t, c.name+" p", res.PValue, c.p, 1e-8)
+		near(t, c.name+" OR", res.EffectSize, c.or, 1e-9)
+	}
+}
+
+func TestUntestableData(t *testing.T) {
+	_, errT := tTest([]float64{1, 1}, []float64{2, 2}, false)
+	_, errMW := mannWhitney([]float64{3, 3}, []float64{3})
+	_, errANOVA := oneWayANOVA([][]float64{{1, 1}, {2, 2}})
+	_, errKW := kruskalWallis([][]float64{{4, 4}, {4}})
+	_, errChi := chiSquareTest(crosstab([][]int{{0, 3}, {0, 5}}))
+	_, errFisher := fisherExact(crosstab([][]int{{0, 0}, {0, 0}}))
+	for name, err := range map[string]error{
+		"t": errT, "mann-whitney": errMW, "anova": errANOVA, "kruskal": errKW, "chi-square": errChi, "fisher": errFisher,
+	} {
+		var ierr *InputError
+		if !errors.As(err, &ierr) {
+			t.Errorf("%s: got %v, want an InputError", name, err)
+		}
+	}
+}
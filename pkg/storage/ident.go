@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Table and column names end up inside SQL text, so every name coming from a
+// client is checked with checkTableName/checkFieldName (or CheckTable for existing
+// tables) and every statement writes it through quoteIdent.
+
+var identPattern = regexp.MustCompile(`^[\p{L}_][\p{L}\p{N}_]{0,63}$`)
+
+// internalTables hold storage's own bookkeeping and are never user tables.
+var internalTables = []string{
+	"table_meta", "column_meta", "table_grants", "saved_views",
+	"row_versions", "schema_versions", "audit_log", "users", "sessions",
+}
+
+// TableNotFoundError is returned for names that are not live user tables.
+type TableNotFoundError struct {
+	Table string
+}
+
+func (e *TableNotFoundError) Error() string {
+	return fmt.Sprintf("表 %s 不存在", e.Table)
+}
+
+// quoteIdent renders a name as an SQLite quoted identifier.
+func quoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// qualify renders table.column with both parts quoted.
+func qualify(table, column string) string {
+	return quoteIdent(table) + "." + quoteIdent(column)
+}
+
+func quoteAll(names []string) []string {
+	out := make([]string, len(names))
+	for i, n := range names {
+		out[i] = quoteIdent(n)
+	}
+	return out
+}
+
+func checkIdent(kind, name string) error {
+	if !identPattern.MatchString(name) {
+		return fmt.Errorf("%s %q 不合法：只能包含字母、数字和下划线，不能以数字开头，最长 64 个字符", kind, name)
+	}
+	return nil
+}
+
+// checkTableName validates a name for a new or renamed table.
+func checkTableName(name string) error {
+	if err := checkIdent("表名", name); err != nil {
+		return err
+	}
+	lower := strings.ToLower(name)
+	if slices.Contains(internalTables, lower) || strings.HasPrefix(lower, "sqlite_") ||
+		strings.HasSuffix(lower, "_fts") || strings.Contains(lower, "_fts_") || strings.Contains(lower, "_tmp_") {
+		return fmt.Errorf("表名 %s 为系统保留名称", name)
+	}
+	return nil
+}
+
+// checkFieldName validates a name for a new or renamed column.
+func checkFieldName(name string) error {
+	if err := checkIdent("字段名", name); err != nil {
+		return err
+	}
+	if isSystemColumn(strings.ToLower(name)) || strings.HasPrefix(name, "__") {
+		return fmt.Errorf("字段名 %s 为系统保留名称", name)
+	}
+	return nil
+}
+
+// CheckTable reports a TableNotFoundError unless table is a live user table.
+func (s *Storage) CheckTable(ctx context.Context, table string) error {
+	if checkIdent("表名", table) != nil {
+		return &TableNotFoundError{Table: table}
+	}
+	var n int
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(1) FROM table_meta WHERE table_name=? AND deleted_at IS NULL`, table).Scan(&n); err != nil {
+		return err
+	}
+	if n == 0 {
+		return &TableNotFoundError{Table: table}
+	}
+	return nil
+}
@@ -0,0 +1,212 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"maps"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// Fields flagged unique or indexed get an index named uq_<n>_<table>_<col> or
+// idx_<n>_<table>_<col>, where n is the length of the table name so that table
+// a_b column c and table a column b_c never share a name. Unique indexes only
+// cover live rows, so a value in the recycle bin does not block new entries
+// (restoring it may then conflict).
+
+const uniqueFailedPrefix = "UNIQUE constraint failed: "
+
+// UniqueError reports a write that would duplicate a unique field's value.
+type UniqueError struct {
+	Field string
+	Value any
+	RowID int64
+}
+
+func (e *UniqueError) Error() string {
+	if e.RowID > 0 {
+		return fmt.Sprintf("字段 %s 的值 %v 已存在（记录 %d）", e.Field, e.Value, e.RowID)
+	}
+	return fmt.Sprintf("字段 %s 存在重复值", e.Field)
+}
+
+func indexName(table, column string, unique bool) string {
+	prefix := "idx_"
+	if unique {
+		prefix = "uq_"
+	}
+	return fmt.Sprintf("%s%d_%s_%s", prefix, len(table), table, column)
+}
+
+// ensureIndexes renames indexes created under the old uq_<table>_<col> scheme by
+// syncing every table's indexes with its fields.
+func (s *Storage) ensureIndexes() error {
+	ctx := context.Background()
+	rows, err := s.db.QueryContext(ctx, `SELECT table_name FROM table_meta`)
+	if err != nil {
+		return err
+	}
+	var tables []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return err
+		}
+		tables = append(tables, name)
+	}
+	rows.Close()
+	for _, t := range tables {
+		if err := s.migrateIndexes(ctx, t); err != nil {
+			s.l.Error("migrate indexes failed", zap.String("table", t), zap.Error(err))
+		}
+	}
+	return nil
+}
+
+func (s *Storage) migrateIndexes(ctx context.Context, table string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	fields, err := s.readColumns(ctx, tx, table)
+	if err != nil {
+		return err
+	}
+	existing, err := managedIndexes(ctx, tx, table)
+	if err != nil {
+		return err
+	}
+	if maps.Equal(existing, wantedIndexes(table, fields)) {
+		return nil
+	}
+	if err := s.syncIndexes(ctx, tx, table, fields); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// syncIndexes creates and drops managed indexes so they match the fields' flags.
+// Index names embed the table and column, so it also cleans up after renames.
+func (s *Storage) syncIndexes(ctx context.Context, q execer, table string, fields []FieldDefinition) error {
+	existing, err := managedIndexes(ctx, q, table)
+	if err != nil {
+		return err
+	}
+	want := wantedIndexes(table, fields)
+	for name := range existing {
+		if want[name] {
+			continue
+		}
+		if _, err := q.ExecContext(ctx, "DROP INDEX IF EXISTS "+quoteIdent(name)); err != nil {
+			return err
+		}
+	}
+	return s.createIndexes(ctx, q, table, fields)
+}
+
+// managedIndexes returns the names of the uq_/idx_ indexes currently on table.
+func managedIndexes(ctx context.Context, q execer, table string) (map[string]bool, error) {
+	rows, err := q.QueryContext(ctx, `SELECT name FROM sqlite_master WHERE type='index' AND tbl_name=?
+		AND (name LIKE 'uq\_%' ESCAPE '\' OR name LIKE 'idx\_%' ESCAPE '\')`, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	existing := map[string]bool{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		existing[name] = true
+	}
+	return existing, rows.Err()
+}
+
+func wantedIndexes(table string, fields []FieldDefinition) map[string]bool {
+	want := map[string]bool{}
+	for _, f := range fields {
+		if f.Unique || f.Indexed {
+			want[indexName(table, f.Name, f.Unique)] = true
+		}
+	}
+	return want
+}
+
+// createIndexes adds the missing indexes of the given fields without touching others.
+func (s *Storage) createIndexes(ctx context.Context, q execer, table string, fields []FieldDefinition) error {
+	for _, f := range fields {
+		if !f.Unique && !f.Indexed {
+			continue
+		}
+		name := indexName(table, f.Name, f.Unique)
+		var n int
+		_ = q.QueryRowContext(ctx, `SELECT COUNT(1) FROM sqlite_master WHERE type='index' AND name=? AND tbl_name=?`, name, table).Scan(&n)
+		if n > 0 {
+			continue
+		}
+		stmt := fmt.Sprintf("CREATE INDEX %s ON %s(%s)", quoteIdent(name), quoteIdent(table), quoteIdent(f.Name))
+		if f.Unique {
+			if err := checkDuplicates(ctx, q, table, f.Name); err != nil {
+				return err
+			}
+			stmt = fmt.Sprintf("CREATE UNIQUE INDEX %s ON %s(%s) WHERE deleted_at IS NULL", quoteIdent(name), quoteIdent(table), quoteIdent(f.Name))
+		}
+		if _, err := q.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+		s.l.Info("create index", zap.String("table", table), zap.String("index", name))
+	}
+	return nil
+}
+
+// checkDuplicates fails when live rows already share a value of column.
+func checkDuplicates(ctx context.Context, q execer, table, column string) error {
+	var value any
+	var ids string
+	col := quoteIdent(column)
+	err := q.QueryRowContext(ctx, fmt.Sprintf(`SELECT %s, GROUP_CONCAT(id) FROM %s
+		WHERE deleted_at IS NULL AND %s IS NOT NULL GROUP BY %s HAVING COUNT(1) > 1 LIMIT 1`, col, quoteIdent(table), col, col)).Scan(&value, &ids)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("字段 %s 存在重复值 %v（记录 %s），无法设为唯一", column, value, ids)
+}
+
+// uniqueError turns SQLite's unique violation into a UniqueError naming the field
+// and, when the written values are known, the live row that already holds it.
+func uniqueError(ctx context.Context, q execer, table string, err error, values map[string]any, self int64) error {
+	if err == nil {
+		return nil
+	}
+	msg := err.Error()
+	i := strings.Index(msg, uniqueFailedPrefix)
+	if i < 0 {
+		return err
+	}
+	target := msg[i+len(uniqueFailedPrefix):]
+	if end := strings.IndexAny(target, " ,("); end >= 0 {
+		target = target[:end]
+	}
+	_, column, ok := strings.Cut(target, ".")
+	if !ok {
+		return err
+	}
+	uerr := &UniqueError{Field: column}
+	value, ok := values[column]
+	if !ok {
+		return uerr
+	}
+	uerr.Value = value
+	_ = q.QueryRowContext(ctx, fmt.Sprintf("SELECT id FROM %s WHERE %s=? AND deleted_at IS NULL AND id!=? LIMIT 1", quoteIdent(table), quoteIdent(column)),
+		value, self).Scan(&uerr.RowID)
+	return uerr
+}
@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+)
+
+// Keyset pagination continues after the last row of the previous page instead of
+// skipping OFFSET rows, so deep pages cost the same as the first one. The cursor is
+// the sort key and id of that last row; id breaks ties so rows with equal keys are
+// neither skipped nor repeated.
+
+// cursorKeyColumn carries the sort key in the result set when the key is not a
+// plain column of the row (e.g. the search rank).
+const cursorKeyColumn = "__cursor_key"
+
+type pageCursor struct {
+	Key any   `json:"k"`
+	ID  int64 `json:"id"`
+}
+
+// QueryResult is one page of Query. Total is only filled when it was asked for;
+// NextCursor is empty on the last page.
+type QueryResult struct {
+	Items      []map[string]any
+	Total      int
+	NextCursor string
+}
+
+func encodeCursor(key any, id int64) string {
+	if b, ok := key.([]byte); ok {
+		key = string(b)
+	}
+	raw, _ := json.Marshal(pageCursor{Key: key, ID: id})
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeCursor(s string) (*pageCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, filterErr("分页游标无效")
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var c pageCursor
+	if err := dec.Decode(&c); err != nil || c.ID <= 0 {
+		return nil, filterErr("分页游标无效")
+	}
+	if n, ok := c.Key.(json.Number); ok {
+		if i, err := n.Int64(); err == nil {
+			c.Key = i
+		} else if f, err := n.Float64(); err == nil {
+			c.Key = f
+		}
+	}
+	return &c, nil
+}
+
+// keysetClause selects the rows after c in ORDER BY key, id (both in the same
+// direction). SQLite sorts NULL before every value, which the NULL branches follow.
+func keysetClause(key, idCol string, desc bool, c *pageCursor) (string, []any) {
+	if key == idCol {
+		return fmt.Sprintf("%s %s ?", idCol, ternary(desc, "<", ">")), []any{c.ID}
+	}
+	cmp := ternary(desc, "<", ">")
+	if c.Key == nil {
+		if desc {
+			return fmt.Sprintf("(%s IS NULL AND %s < ?)", key, idCol), []any{c.ID}
+		}
+		return fmt.Sprintf("((%s IS NULL AND %s > ?) OR %s IS NOT NULL)", key, idCol, key), []any{c.ID}
+	}
+	clause := fmt.Sprintf("(%s %s ? OR (%s = ? AND %s %s ?)", key, cmp, key, idCol, cmp)
+	if desc {
+		clause += fmt.Sprintf(" OR %s IS NULL", key)
+	}
+	return clause + ")", []any{c.Key, c.Key, c.ID}
+}
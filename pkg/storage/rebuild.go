@@ -0,0 +1,356 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const AuditConvertColumn = "convert_column"
+
+// columnDecl is one column as SQLite has it declared, so a rebuilt table keeps the
+// original types, NOT NULL constraints and defaults.
+type columnDecl struct {
+	name    string
+	ctype   string
+	notNull bool
+	dflt    sql.NullString
+	pk      bool
+}
+
+func (d columnDecl) sql() string {
+	if d.pk {
+		return quoteIdent(d.name) + " INTEGER PRIMARY KEY AUTOINCREMENT"
+	}
+	out := quoteIdent(d.name)
+	if d.ctype != "" {
+		out += " " + d.ctype
+	}
+	if d.notNull {
+		out += " NOT NULL"
+	}
+	if d.dflt.Valid {
+		out += " DEFAULT " + d.dflt.String
+	}
+	return out
+}
+
+func tableDecls(ctx context.Context, q execer, table string) ([]columnDecl, error) {
+	rows, err := q.QueryContext(ctx, `SELECT name, type, "notnull", dflt_value, pk FROM pragma_table_info(?) ORDER BY cid`, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var decls []columnDecl
+	for rows.Next() {
+		var d columnDecl
+		if err := rows.Scan(&d.name, &d.ctype, &d.notNull, &d.dflt, &d.pk); err != nil {
+			return nil, err
+		}
+		decls = append(decls, d)
+	}
+	return decls, rows.Err()
+}
+
+// rebuildTable recreates table with the given column declarations, copies every
+// row (recycle bin included) and restores the id sequence, the managed indexes of
+// fields and the full-text index. SQLite cannot drop or retype columns in place.
+func (s *Storage) rebuildTable(ctx context.Context, q execer, table string, decls []columnDecl, fields []FieldDefinition) error {
+	tmp := table + "_tmp_" + fmt.Sprint(time.Now().UnixNano())
+	defs := make([]string, len(decls))
+	names := make([]string, len(decls))
+	for i, d := range decls {
+		defs[i] = d.sql()
+		names[i] = quoteIdent(d.name)
+	}
+	var seq int64
+	_ = q.QueryRowContext(ctx, `SELECT seq FROM sqlite_sequence WHERE name=?`, table).Scan(&seq)
+	cols := strings.Join(names, ", ")
+	stmts := []string{
+		fmt.Sprintf("CREATE TABLE %s (%s)", quoteIdent(tmp), strings.Join(defs, ", ")),
+		fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM %s", quoteIdent(tmp), cols, cols, quoteIdent(table)),
+	}
+	if err := s.dropFTS(ctx, q, table); err != nil {
+		return err
+	}
+	stmts = append(stmts,
+		"DROP TABLE "+quoteIdent(table),
+		"ALTER TABLE "+quoteIdent(tmp)+" RENAME TO "+quoteIdent(table),
+	)
+	for _, stmt := range stmts {
+		if _, err := q.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	// Keep ids of purged rows from being handed out again.
+	if seq > 0 {
+		if _, err := q.ExecContext(ctx, `UPDATE sqlite_sequence SET seq=MAX(seq, ?) WHERE name=?`, seq, table); err != nil {
+			return err
+		}
+		if _, err := q.ExecContext(ctx, `INSERT INTO sqlite_sequence(name, seq) SELECT ?, ? WHERE NOT EXISTS (SELECT 1 FROM sqlite_sequence WHERE name=?)`,
+			table, seq, table); err != nil {
+			return err
+		}
+	}
+	if err := s.createIndexes(ctx, q, table, fields); err != nil {
+		return err
+	}
+	return s.rebuildFTS(ctx, q, table)
+}
+
+// applyNullability rebuilds the table when its NOT NULL constraints differ from
+// the allow_null recorded in column_meta. A column only becomes NOT NULL when no
+// row, recycle bin included, holds NULL in it.
+func (s *Storage) applyNullability(ctx context.Context, q execer, table string) error {
+	fields, err := s.readColumns(ctx, q, table)
+	if err != nil {
+		return err
+	}
+	decls, err := tableDecls(ctx, q, table)
+	if err != nil {
+		return err
+	}
+	allowNull := map[string]bool{}
+	for _, f := range fields {
+		allowNull[f.Name] = f.AllowNull
+	}
+	changed := false
+	var present []string
+	for i := range decls {
+		d := &decls[i]
+		allow, ok := allowNull[d.name]
+		if !ok || d.pk {
+			continue
+		}
+		present = append(present, d.name)
+		if d.notNull != allow {
+			continue
+		}
+		if !allow {
+			var n int
+			if err := q.QueryRowContext(ctx, fmt.Sprintf("SELECT COUNT(1) FROM %s WHERE %s IS NULL", quoteIdent(table), quoteIdent(d.name))).Scan(&n); err != nil {
+				return err
+			}
+			if n > 0 {
+				return fmt.Errorf("字段 %s 有 %d 条记录为空（含回收站），不能设为必填", d.name, n)
+			}
+		}
+		d.notNull = !allow
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	kept := slices.DeleteFunc(fields, func(f FieldDefinition) bool { return !slices.Contains(present, f.Name) })
+	return s.rebuildTable(ctx, q, table, decls, kept)
+}
+
+// ConvertRequest changes a column's type. Options are required when converting to
+// a choice type; Rules replace the field's rules when given.
+type ConvertRequest struct {
+	Column   string        `json:"column"`
+	TypeHint string        `json:"type_hint"`
+	Options  []FieldOption `json:"options,omitempty"`
+	Rules    *FieldRules   `json:"rules,omitempty"`
+	DryRun   bool          `json:"dry_run"`
+}
+
+// ConvertIssue is a value that cannot be represented in the new type.
+type ConvertIssue struct {
+	RowID int64  `json:"row_id"`
+	Value string `json:"value"`
+	Error string `json:"error"`
+}
+
+type ConvertReport struct {
+	Table   string         `json:"table"`
+	Column  string         `json:"column"`
+	From    string         `json:"from"`
+	To      string         `json:"to"`
+	DryRun  bool           `json:"dry_run"`
+	Values  int            `json:"values"`
+	Changed int            `json:"changed"`
+	Failed  int            `json:"failed"`
+	Issues  []ConvertIssue `json:"issues"`
+}
+
+const maxConvertIssues = 200
+
+// ConvertError rejects a schema change because some values do not convert to the
+// new type; the report lists them.
+type ConvertError struct {
+	Report *ConvertReport
+}
+
+func (e *ConvertError) Error() string {
+	r := e.Report
+	issue := r.Issues[0]
+	return fmt.Sprintf("字段 %s 有 %d 个值无法转换为 %s（如记录 %d 的值 %q：%s）",
+		r.Column, r.Failed, r.To, issue.RowID, issue.Value, issue.Error)
+}
+
+// ConvertColumn converts every value of a column (recycle bin included) to a new
+// type and rebuilds the table with the matching declared type. Nothing is written
+// on a dry run or when any value fails to convert; the report lists the failures
+// either way.
+func (s *Storage) ConvertColumn(ctx context.Context, table string, req ConvertRequest) (*ConvertReport, error) {
+	if err := s.CheckTable(ctx, table); err != nil {
+		return nil, err
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	report, err := s.convertColumn(ctx, tx, table, req)
+	if err != nil || req.DryRun {
+		return report, err
+	}
+	if err := s.recordSchema(ctx, tx, AuditConvertColumn, table); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	s.l.Info("convert column", zap.String("table", table), zap.String("column", req.Column),
+		zap.String("from", report.From), zap.String("to", report.To), zap.Int("changed", report.Changed))
+	return report, nil
+}
+
+func (s *Storage) convertColumn(ctx context.Context, tx execer, table string, req ConvertRequest) (*ConvertReport, error) {
+	fields, err := s.readColumns(ctx, tx, table)
+	if err != nil {
+		return nil, err
+	}
+	idx := slices.IndexFunc(fields, func(f FieldDefinition) bool { return f.Name == req.Column })
+	if idx < 0 {
+		return nil, fmt.Errorf("字段 %s 不存在", req.Column)
+	}
+	sqlType := mapType(req.TypeHint)
+	if sqlType == "" {
+		return nil, fmt.Errorf("不支持的类型 %s", req.TypeHint)
+	}
+	old := fields[idx]
+	target := old
+	target.TypeHint = req.TypeHint
+	target.Options = nil
+	if req.Rules != nil {
+		target.Rules = req.Rules
+	}
+	if isChoiceHint(req.TypeHint) {
+		target.Options = req.Options
+		if target.Options == nil && isChoiceHint(old.TypeHint) {
+			target.Options = old.Options
+		}
+	}
+	names := make([]string, len(fields))
+	for i, f := range fields {
+		names[i] = f.Name
+	}
+	if err := validateField(target, names); err != nil {
+		return nil, err
+	}
+
+	rows, err := selectRows(ctx, tx, fmt.Sprintf("SELECT * FROM %s ORDER BY id", quoteIdent(table)))
+	if err != nil {
+		return nil, err
+	}
+	report := &ConvertReport{Table: table, Column: req.Column, From: old.TypeHint, To: req.TypeHint, DryRun: req.DryRun, Issues: []ConvertIssue{}}
+	changed := map[int64]any{}
+	for _, row := range rows {
+		id, _ := row["id"].(int64)
+		raw := row[req.Column]
+		if isBlank(raw) {
+			continue
+		}
+		report.Values++
+		conv, err := convertField(target, raw)
+		if err == nil && conv == nil && !target.AllowNull {
+			err = fmt.Errorf("不能为空")
+		}
+		if err != nil {
+			report.Failed++
+			if len(report.Issues) < maxConvertIssues {
+				report.Issues = append(report.Issues, ConvertIssue{RowID: id, Value: fmt.Sprint(raw), Error: err.Error()})
+			}
+			continue
+		}
+		if b, ok := conv.(bool); ok {
+			conv = int64(boolToInt(b))
+		}
+		if !reflect.DeepEqual(conv, raw) {
+			changed[id] = conv
+			report.Changed++
+		}
+	}
+	if req.DryRun {
+		return report, nil
+	}
+	if report.Failed > 0 {
+		return report, fmt.Errorf("字段 %s 有 %d 个值无法转换为 %s，未做修改", req.Column, report.Failed, req.TypeHint)
+	}
+
+	decls, err := tableDecls(ctx, tx, table)
+	if err != nil {
+		return nil, err
+	}
+	for i := range decls {
+		if decls[i].name != req.Column {
+			continue
+		}
+		decls[i].ctype = sqlType
+		if decls[i].dflt.Valid && !defaultConverts(target, decls[i].dflt.String) {
+			decls[i].dflt = sql.NullString{}
+		}
+	}
+	fields[idx] = target
+	if err := s.rebuildTable(ctx, tx, table, decls, nil); err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		id, _ := row["id"].(int64)
+		conv, ok := changed[id]
+		if !ok {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf("UPDATE %s SET %s=? WHERE id=?", quoteIdent(table), quoteIdent(req.Column)), conv, id); err != nil {
+			return nil, uniqueError(ctx, tx, table, err, map[string]any{req.Column: conv}, id)
+		}
+		row[req.Column] = conv
+		if err := s.recordVersion(ctx, tx, AuditConvertColumn, table, id, row); err != nil {
+			return nil, err
+		}
+	}
+	// Unique indexes go back only after the values are final.
+	if err := s.createIndexes(ctx, tx, table, fields); err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE column_meta SET type_hint=?, options=?, rules=? WHERE table_name=? AND column_name=?`,
+		target.TypeHint, optionsJSON(target.Options), rulesJSON(target.Rules), table, target.Name); err != nil {
+		return nil, err
+	}
+	if err := s.audit(ctx, tx, AuditConvertColumn, table, 0, old, map[string]any{"field": target, "changed": report.Changed}); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// defaultConverts reports whether a declared DEFAULT literal is valid in the new type.
+func defaultConverts(def FieldDefinition, literal string) bool {
+	v, err := convertField(def, unquoteDefault(literal))
+	return err == nil && v != nil
+}
+
+// unquoteDefault turns a quoted dflt_value literal back into its text.
+func unquoteDefault(literal string) string {
+	if len(literal) >= 2 && literal[0] == '\'' && literal[len(literal)-1] == '\'' {
+		return strings.ReplaceAll(literal[1:len(literal)-1], "''", "'")
+	}
+	return literal
+}
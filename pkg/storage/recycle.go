@@ -0,0 +1,212 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	AuditRestore      = "restore"
+	AuditRestoreTable = "restore_table"
+	AuditPurge        = "purge"
+)
+
+type DeletedTable struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"display_name"`
+	DeletedAt   string `json:"deleted_at"`
+}
+
+// ensureSoftDelete adds deleted_at to table_meta and to every user table created
+// before soft delete existed.
+func (s *Storage) ensureSoftDelete() error {
+	var count int
+	_ = s.db.QueryRow(`SELECT COUNT(1) FROM pragma_table_info('table_meta') WHERE name='deleted_at'`).Scan(&count)
+	if count == 0 {
+		if _, err := s.db.Exec(`ALTER TABLE table_meta ADD COLUMN deleted_at DATETIME`); err != nil {
+			return err
+		}
+	}
+	rows, err := s.db.Query(`SELECT table_name FROM table_meta`)
+	if err != nil {
+		return err
+	}
+	var tables []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return err
+		}
+		tables = append(tables, name)
+	}
+	rows.Close()
+	for _, t := range tables {
+		var n int
+		_ = s.db.QueryRow(`SELECT COUNT(1) FROM pragma_table_info(?) WHERE name='deleted_at'`, t).Scan(&n)
+		if n > 0 {
+			continue
+		}
+		if _, err := s.db.Exec("ALTER TABLE " + quoteIdent(t) + " ADD COLUMN deleted_at DATETIME"); err != nil {
+			s.l.Error("add deleted_at failed", zap.String("table", t), zap.Error(err))
+		}
+	}
+	return nil
+}
+
+// DeletedRows lists soft-deleted rows of a table, most recently deleted first.
+func (s *Storage) DeletedRows(ctx context.Context, table string) ([]map[string]any, error) {
+	return selectRows(ctx, s.db, fmt.Sprintf("SELECT * FROM %s WHERE deleted_at IS NOT NULL ORDER BY deleted_at DESC, id DESC", quoteIdent(table)))
+}
+
+func (s *Storage) RestoreRows(ctx context.Context, table string, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	ph := placeholders(len(ids))
+	args := toAny64(ids)
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	rows, err := selectRows(ctx, tx, fmt.Sprintf("SELECT * FROM %s WHERE deleted_at IS NOT NULL AND id IN (%s)", quoteIdent(table), ph), args...)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("UPDATE %s SET deleted_at=NULL WHERE deleted_at IS NOT NULL AND id IN (%s)", quoteIdent(table), ph), args...); err != nil {
+		return uniqueError(ctx, tx, table, err, nil, 0)
+	}
+	for _, before := range rows {
+		id, _ := before["id"].(int64)
+		after, err := fetchRow(ctx, tx, table, id)
+		if err != nil {
+			return err
+		}
+		if err := s.audit(ctx, tx, AuditRestore, table, id, before, after); err != nil {
+			return err
+		}
+		if err := s.recordVersion(ctx, tx, AuditRestore, table, id, after); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *Storage) DeletedTables(ctx context.Context) ([]DeletedTable, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT table_name, COALESCE(display_name,''), strftime('%Y-%m-%d %H:%M:%S', deleted_at)
+		FROM table_meta WHERE deleted_at IS NOT NULL ORDER BY deleted_at DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var tables []DeletedTable
+	for rows.Next() {
+		var t DeletedTable
+		if err := rows.Scan(&t.Name, &t.DisplayName, &t.DeletedAt); err != nil {
+			return nil, err
+		}
+		tables = append(tables, t)
+	}
+	return tables, rows.Err()
+}
+
+func (s *Storage) RestoreTable(ctx context.Context, table string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	res, err := tx.ExecContext(ctx, `UPDATE table_meta SET deleted_at=NULL WHERE table_name=? AND deleted_at IS NOT NULL`, table)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("回收站中没有表 %s", table)
+	}
+	if err := s.audit(ctx, tx, AuditRestoreTable, table, 0, nil, nil); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// PurgeResult reports what a purge removed for good.
+type PurgeResult struct {
+	Rows   int64    `json:"rows"`
+	Tables []string `json:"tables"`
+}
+
+// Purge permanently removes rows and tables that have been in the recycle bin longer
+// than the retention period.
+func (s *Storage) Purge(ctx context.Context, retention time.Duration) (*PurgeResult, error) {
+	cutoff := time.Now().Add(-retention).UTC().Format("2006-01-02 15:04:05")
+	result := &PurgeResult{Tables: []string{}}
+
+	rows, err := s.db.QueryContext(ctx, `SELECT table_name FROM table_meta WHERE deleted_at IS NOT NULL AND deleted_at<=?`, cutoff)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		result.Tables = append(result.Tables, name)
+	}
+	rows.Close()
+
+	live, err := s.ListTables(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	for _, t := range live {
+		// Their version snapshots go too, or the data would stay readable in history.
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf(`DELETE FROM row_versions WHERE table_name=? AND row_id IN
+			(SELECT id FROM %s WHERE deleted_at IS NOT NULL AND deleted_at<=?)`, quoteIdent(t.Name)), t.Name, cutoff); err != nil {
+			return nil, err
+		}
+		res, err := tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE deleted_at IS NOT NULL AND deleted_at<=?", quoteIdent(t.Name)), cutoff)
+		if err != nil {
+			return nil, err
+		}
+		n, _ := res.RowsAffected()
+		if n == 0 {
+			continue
+		}
+		result.Rows += n
+		if err := s.audit(ctx, tx, AuditPurge, t.Name, 0, nil, map[string]any{"rows": n, "before": cutoff}); err != nil {
+			return nil, err
+		}
+	}
+	for _, name := range result.Tables {
+		if err := s.dropFTS(ctx, tx, name); err != nil {
+			return nil, err
+		}
+		if _, err := tx.ExecContext(ctx, "DROP TABLE IF EXISTS "+quoteIdent(name)); err != nil {
+			return nil, err
+		}
+		for _, meta := range []string{"table_meta", "column_meta", "table_grants", "row_versions", "schema_versions", "saved_views"} {
+			if _, err := tx.ExecContext(ctx, "DELETE FROM "+meta+" WHERE table_name=?", name); err != nil {
+				return nil, err
+			}
+		}
+		if err := s.audit(ctx, tx, AuditPurge, name, 0, nil, map[string]any{"table": name}); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	s.l.Info("purge recycle bin", zap.Int64("rows", result.Rows), zap.Strings("tables", result.Tables))
+	return result, nil
+}
@@ -0,0 +1,211 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// FieldRules are data-entry checks stored in column_meta.rules and enforced on
+// every write, imports included. Min/Max apply to numeric fields; MinLength,
+// MaxLength and Pattern to text. Pattern must match the whole value.
+type FieldRules struct {
+	Min        *float64    `json:"min,omitempty"`
+	Max        *float64    `json:"max,omitempty"`
+	MinLength  int         `json:"min_length,omitempty"`
+	MaxLength  int         `json:"max_length,omitempty"`
+	Pattern    string      `json:"pattern,omitempty"`
+	RequiredIf *RequiredIf `json:"required_if,omitempty"`
+}
+
+// RequiredIf makes a field mandatory when Field holds one of Values (option labels
+// are accepted for choice fields), or when Field is filled at all if Values is empty.
+type RequiredIf struct {
+	Field  string `json:"field"`
+	Values []any  `json:"values,omitempty"`
+}
+
+// InputError marks data supplied with a request that cannot be accepted, such as
+// a value breaking its field's rules or data a statistical test cannot run on.
+// The API answers 400 with the message as is.
+type InputError struct {
+	Msg string
+}
+
+func (e *InputError) Error() string {
+	return e.Msg
+}
+
+func inputErr(format string, args ...any) error {
+	return &InputError{Msg: fmt.Sprintf(format, args...)}
+}
+
+var patternCache sync.Map
+
+func compilePattern(p string) (*regexp.Regexp, error) {
+	if re, ok := patternCache.Load(p); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(`^(?:` + p + `)$`)
+	if err != nil {
+		return nil, err
+	}
+	patternCache.Store(p, re)
+	return re, nil
+}
+
+func rulesJSON(r *FieldRules) string {
+	if r == nil {
+		return ""
+	}
+	raw, _ := json.Marshal(r)
+	return string(raw)
+}
+
+// validateField checks a field definition's options and rules; columns are the
+// names the table will have, for required_if references.
+func validateField(f FieldDefinition, columns []string) error {
+	if err := validateOptions(f); err != nil {
+		return err
+	}
+	r := f.Rules
+	if r == nil {
+		return nil
+	}
+	numeric := isNumericHint(f.TypeHint)
+	if (r.Min != nil || r.Max != nil) && !numeric {
+		return fmt.Errorf("字段 %s 不是数值类型，不能设置最小/最大值", f.Name)
+	}
+	if r.Min != nil && r.Max != nil && *r.Min > *r.Max {
+		return fmt.Errorf("字段 %s 的最小值大于最大值", f.Name)
+	}
+	if (r.MinLength != 0 || r.MaxLength != 0 || r.Pattern != "") && (numeric || isChoiceHint(f.TypeHint)) {
+		return fmt.Errorf("字段 %s 不是文本类型，不能设置长度或格式", f.Name)
+	}
+	if r.MinLength < 0 || r.MaxLength < 0 || (r.MaxLength > 0 && r.MinLength > r.MaxLength) {
+		return fmt.Errorf("字段 %s 的长度限制无效", f.Name)
+	}
+	if r.Pattern != "" {
+		if _, err := compilePattern(r.Pattern); err != nil {
+			return fmt.Errorf("字段 %s 的格式表达式无效: %v", f.Name, err)
+		}
+	}
+	if ri := r.RequiredIf; ri != nil {
+		if ri.Field == f.Name || !slices.Contains(columns, ri.Field) {
+			return fmt.Errorf("字段 %s 的必填条件引用了无效字段 %s", f.Name, ri.Field)
+		}
+	}
+	return nil
+}
+
+// checkValue applies the value rules to a converted, non-empty value.
+func (f FieldDefinition) checkValue(v any) error {
+	r := f.Rules
+	if r == nil {
+		return nil
+	}
+	var num float64
+	isNum := true
+	switch x := v.(type) {
+	case int:
+		num = float64(x)
+	case int32:
+		num = float64(x)
+	case int64:
+		num = float64(x)
+	case float64:
+		num = x
+	default:
+		isNum = false
+	}
+	if isNum {
+		if r.Min != nil && num < *r.Min {
+			return fmt.Errorf("不能小于 %v", *r.Min)
+		}
+		if r.Max != nil && num > *r.Max {
+			return fmt.Errorf("不能大于 %v", *r.Max)
+		}
+	}
+	if text, ok := v.(string); ok {
+		n := utf8.RuneCountInString(text)
+		if r.MinLength > 0 && n < r.MinLength {
+			return fmt.Errorf("长度不能少于 %d 个字符", r.MinLength)
+		}
+		if r.MaxLength > 0 && n > r.MaxLength {
+			return fmt.Errorf("长度不能超过 %d 个字符", r.MaxLength)
+		}
+		if r.Pattern != "" {
+			re, err := compilePattern(r.Pattern)
+			if err != nil {
+				return err
+			}
+			if !re.MatchString(text) {
+				return errors.New("格式不正确")
+			}
+		}
+	}
+	return nil
+}
+
+// checkRequiredIf validates the conditional requirements against a complete row.
+func checkRequiredIf(meta map[string]FieldDefinition, row map[string]any) error {
+	for name, def := range meta {
+		if def.Rules == nil || def.Rules.RequiredIf == nil || !isBlank(row[name]) {
+			continue
+		}
+		ri := def.Rules.RequiredIf
+		if conditionHolds(meta[ri.Field], row[ri.Field], ri.Values) {
+			if len(ri.Values) == 0 {
+				return inputErr("字段 %s 在填写 %s 时必填", name, ri.Field)
+			}
+			return inputErr("字段 %s 在 %s 为 %v 时必填", name, ri.Field, ri.Values)
+		}
+	}
+	return nil
+}
+
+func conditionHolds(def FieldDefinition, current any, values []any) bool {
+	if isBlank(current) {
+		return false
+	}
+	if len(values) == 0 {
+		return true
+	}
+	held := []string{fmt.Sprint(current)}
+	if isMultiHint(def.TypeHint) {
+		var codes []string
+		if json.Unmarshal([]byte(fmt.Sprint(current)), &codes) == nil {
+			held = codes
+		}
+	}
+	if b, ok := current.(bool); ok {
+		held = []string{fmt.Sprint(boolToInt(b))}
+	}
+	for _, want := range values {
+		target := fmt.Sprint(want)
+		if isChoiceHint(def.TypeHint) {
+			if code, err := def.optionCode(want); err == nil {
+				target = code
+			}
+		}
+		for _, h := range held {
+			if strings.EqualFold(h, target) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isBlank(v any) bool {
+	if v == nil {
+		return true
+	}
+	s, ok := v.(string)
+	return ok && strings.TrimSpace(s) == ""
+}
@@ -0,0 +1,37 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPrepareDataRejectsBadInput(t *testing.T) {
+	maxIOP := 60.0
+	meta := map[string]FieldDefinition{
+		"iop": {Name: "iop", TypeHint: "number", AllowNull: true, Rules: &FieldRules{Max: &maxIOP}},
+		"mrn": {Name: "mrn", TypeHint: "text", AllowNull: false, Rules: &FieldRules{Pattern: `[A-Z]\d{6}`}},
+		"eye": {Name: "eye", TypeHint: "text", AllowNull: true},
+		"va":  {Name: "va", TypeHint: "text", AllowNull: true, Rules: &FieldRules{RequiredIf: &RequiredIf{Field: "eye"}}},
+	}
+	cases := []struct {
+		name string
+		data map[string]any
+	}{
+		{"above max", map[string]any{"mrn": "A123456", "iop": 75.0}},
+		{"pattern", map[string]any{"mrn": "123456"}},
+		{"required", map[string]any{"iop": 12.0}},
+		{"not a number", map[string]any{"mrn": "A123456", "iop": "high"}},
+		{"required if", map[string]any{"mrn": "A123456", "eye": "右眼"}},
+	}
+	s := &Storage{}
+	for _, c := range cases {
+		_, err := s.prepareDataWithMeta(c.data, meta, true)
+		var ierr *InputError
+		if !errors.As(err, &ierr) {
+			t.Errorf("%s: got %v, want an InputError", c.name, err)
+		}
+	}
+	if _, err := s.prepareDataWithMeta(map[string]any{"mrn": "A123456", "iop": 21.0, "eye": "右眼", "va": "0.8"}, meta, true); err != nil {
+		t.Errorf("valid row rejected: %v", err)
+	}
+}
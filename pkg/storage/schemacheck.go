@@ -0,0 +1,240 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+const AuditRepairSchema = "repair_schema"
+
+// Kinds of drift between the physical tables and column_meta.
+const (
+	DriftMissingTable  = "missing_table"  // table_meta entry without a table
+	DriftMissingColumn = "missing_column" // column_meta entry without a column
+	DriftMissingMeta   = "missing_meta"   // column without a column_meta entry
+	DriftType          = "type_mismatch"  // declared type differs from the type hint
+	DriftNull          = "null_mismatch"  // NOT NULL differs from allow_null
+	DriftIndex         = "index_mismatch" // managed indexes differ from unique/indexed
+	DriftSearch        = "search_index"   // full-text index missing or stale
+)
+
+type SchemaIssue struct {
+	Table    string `json:"table"`
+	Column   string `json:"column,omitempty"`
+	Kind     string `json:"kind"`
+	Detail   string `json:"detail"`
+	Repaired bool   `json:"repaired"`
+	Error    string `json:"error,omitempty"`
+}
+
+type SchemaReport struct {
+	Repair bool          `json:"repair"`
+	Tables []string      `json:"tables"`
+	Issues []SchemaIssue `json:"issues"`
+}
+
+// CheckSchema compares PRAGMA table_info with column_meta for one table (or all
+// live tables when table is empty). With repair, each table's fixes run in one
+// transaction: metadata follows the physical table for missing entries and
+// NOT NULL, while declared types are converted to the type hint (refused, and
+// reported, when values do not convert).
+func (s *Storage) CheckSchema(ctx context.Context, table string, repair bool) (*SchemaReport, error) {
+	var tables []string
+	if table != "" {
+		if err := s.CheckTable(ctx, table); err != nil {
+			return nil, err
+		}
+		tables = []string{table}
+	} else {
+		all, err := s.ListTables(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range all {
+			tables = append(tables, t.Name)
+		}
+	}
+	report := &SchemaReport{Repair: repair, Tables: tables, Issues: []SchemaIssue{}}
+	for _, t := range tables {
+		issues, err := s.checkTableSchema(ctx, t, repair)
+		if err != nil {
+			return nil, fmt.Errorf("检查表 %s 失败: %w", t, err)
+		}
+		report.Issues = append(report.Issues, issues...)
+	}
+	s.l.Info("check schema", zap.Strings("tables", tables), zap.Bool("repair", repair), zap.Int("issues", len(report.Issues)))
+	return report, nil
+}
+
+func (s *Storage) checkTableSchema(ctx context.Context, table string, repair bool) ([]SchemaIssue, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	decls, err := tableDecls(ctx, tx, table)
+	if err != nil {
+		return nil, err
+	}
+	if len(decls) == 0 {
+		return []SchemaIssue{{Table: table, Kind: DriftMissingTable, Detail: "table_meta 中登记的表不存在，需从备份恢复"}}, nil
+	}
+	fields, err := s.readColumns(ctx, tx, table)
+	if err != nil {
+		return nil, err
+	}
+	physical := map[string]columnDecl{}
+	var order []string
+	for _, d := range decls {
+		if !isSystemColumn(d.name) {
+			physical[d.name] = d
+			order = append(order, d.name)
+		}
+	}
+
+	// Index and search state is read up front: a type repair rebuilds the table,
+	// which recreates both, and the report should still list the drift found.
+	existing, err := managedIndexes(ctx, tx, table)
+	if err != nil {
+		return nil, err
+	}
+	text, err := textColumns(ctx, tx, table)
+	if err != nil {
+		return nil, err
+	}
+	indexed, err := ftsColumns(ctx, tx, table)
+	if err != nil {
+		return nil, err
+	}
+
+	var issues []SchemaIssue
+	// fix records an issue and, when repairing, applies the fix under a
+	// savepoint. A refused fix (values that do not convert, duplicates under a
+	// unique index) is undone and reported without failing the whole check.
+	fix := func(issue SchemaIssue, apply func() error) error {
+		if repair {
+			if _, err := tx.ExecContext(ctx, "SAVEPOINT repair_schema"); err != nil {
+				return err
+			}
+			if err := apply(); err != nil {
+				if _, err := tx.ExecContext(ctx, "ROLLBACK TO repair_schema"); err != nil {
+					return err
+				}
+				issue.Error = err.Error()
+			} else {
+				issue.Repaired = true
+			}
+			if _, err := tx.ExecContext(ctx, "RELEASE repair_schema"); err != nil {
+				return err
+			}
+		}
+		issues = append(issues, issue)
+		return nil
+	}
+
+	var kept []FieldDefinition
+	for _, f := range fields {
+		d, ok := physical[f.Name]
+		if !ok {
+			err := fix(SchemaIssue{Table: table, Column: f.Name, Kind: DriftMissingColumn, Detail: "column_meta 中有该字段，表中不存在"}, func() error {
+				_, err := tx.ExecContext(ctx, `DELETE FROM column_meta WHERE table_name=? AND column_name=?`, table, f.Name)
+				return err
+			})
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		kept = append(kept, f)
+		if f.AllowNull == d.notNull {
+			detail := fmt.Sprintf("column_meta allow_null=%v，表中%s NOT NULL 约束", f.AllowNull, ternary(d.notNull, "有", "无"))
+			err := fix(SchemaIssue{Table: table, Column: f.Name, Kind: DriftNull, Detail: detail}, func() error {
+				return s.applyNullability(ctx, tx, table)
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+		if want := mapType(f.TypeHint); want != "" && !strings.EqualFold(want, d.ctype) {
+			detail := fmt.Sprintf("类型为 %s，应声明为 %s，表中声明为 %s", f.TypeHint, want, d.ctype)
+			err := fix(SchemaIssue{Table: table, Column: f.Name, Kind: DriftType, Detail: detail}, func() error {
+				_, err := s.convertColumn(ctx, tx, table, ConvertRequest{Column: f.Name, TypeHint: f.TypeHint, Options: f.Options, Rules: f.Rules})
+				return err
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	known := map[string]bool{}
+	for _, f := range fields {
+		known[f.Name] = true
+	}
+	for _, name := range order {
+		if known[name] {
+			continue
+		}
+		d := physical[name]
+		f := FieldDefinition{Name: name, Labels: []string{name}, TypeHint: hintForDecl(d.ctype), AllowNull: !d.notNull}
+		err := fix(SchemaIssue{Table: table, Column: name, Kind: DriftMissingMeta, Detail: fmt.Sprintf("表中有该字段（%s），column_meta 中没有", d.ctype)}, func() error {
+			labels, _ := json.Marshal(f.Labels)
+			_, err := tx.ExecContext(ctx, `INSERT INTO column_meta(table_name, column_name, labels, type_hint, allow_null, display_order)
+				VALUES(?,?,?,?,?,(SELECT COALESCE(MAX(display_order),0)+1 FROM column_meta WHERE table_name=?))`,
+				table, name, string(labels), f.TypeHint, boolToInt(f.AllowNull), table)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		kept = append(kept, f)
+	}
+
+	if want := wantedIndexes(table, kept); !maps.Equal(existing, want) {
+		detail := fmt.Sprintf("现有索引 %v，按字段设置应为 %v", slices.Sorted(maps.Keys(existing)), slices.Sorted(maps.Keys(want)))
+		err := fix(SchemaIssue{Table: table, Kind: DriftIndex, Detail: detail}, func() error {
+			return s.syncIndexes(ctx, tx, table, kept)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if !slices.Equal(text, indexed) {
+		detail := fmt.Sprintf("全文索引覆盖 %v，文本字段为 %v", indexed, text)
+		err := fix(SchemaIssue{Table: table, Kind: DriftSearch, Detail: detail}, func() error {
+			return s.rebuildFTS(ctx, tx, table)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if !repair || len(issues) == 0 {
+		return issues, nil
+	}
+	if err := s.recordSchema(ctx, tx, AuditRepairSchema, table); err != nil {
+		return nil, err
+	}
+	if err := s.audit(ctx, tx, AuditRepairSchema, table, 0, nil, issues); err != nil {
+		return nil, err
+	}
+	return issues, tx.Commit()
+}
+
+// hintForDecl picks a type hint for a column that has no metadata.
+func hintForDecl(ctype string) string {
+	switch strings.ToUpper(ctype) {
+	case "INTEGER":
+		return "integer"
+	case "REAL":
+		return "number"
+	default:
+		return "text"
+	}
+}
@@ -0,0 +1,248 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"go.uber.org/zap"
+)
+
+const SchemaBaseline = "baseline"
+
+type SchemaVersion struct {
+	Version  int         `json:"version"`
+	Action   string      `json:"action"`
+	Username string      `json:"username"`
+	Time     string      `json:"time"`
+	Schema   TableSchema `json:"schema"`
+}
+
+// SchemaChange is one difference between two schema versions. Field is empty for
+// table-level attributes; Change is "added", "removed" or "changed", and for a
+// changed field Attribute names what changed (labels, type_hint, options, ...).
+type SchemaChange struct {
+	Field     string `json:"field,omitempty"`
+	Change    string `json:"change"`
+	Attribute string `json:"attribute,omitempty"`
+	From      any    `json:"from,omitempty"`
+	To        any    `json:"to,omitempty"`
+}
+
+// Every schema change stores a full snapshot of the table's definition, so the
+// form as it stood at any date can be shown, compared and exported. Snapshots
+// follow the table through renames. Tables created before versioning existed get
+// a baseline snapshot of their current definition.
+func (s *Storage) ensureSchemaVersions() error {
+	ddl := []string{
+		`CREATE TABLE IF NOT EXISTS schema_versions (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			table_name TEXT NOT NULL,
+			version INTEGER NOT NULL,
+			action TEXT NOT NULL,
+			user_id INTEGER,
+			username TEXT,
+			ts DATETIME DEFAULT CURRENT_TIMESTAMP,
+			schema_json TEXT
+		);`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_schema_versions ON schema_versions(table_name, version);`,
+	}
+	for _, stmt := range ddl {
+		if _, err := s.db.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	ctx := context.Background()
+	rows, err := s.db.QueryContext(ctx, `SELECT table_name FROM table_meta
+		WHERE table_name NOT IN (SELECT table_name FROM schema_versions)`)
+	if err != nil {
+		return err
+	}
+	var tables []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return err
+		}
+		tables = append(tables, name)
+	}
+	rows.Close()
+	for _, t := range tables {
+		if err := s.recordSchema(ctx, s.db, SchemaBaseline, t); err != nil {
+			s.l.Error("record baseline schema failed", zap.String("table", t), zap.Error(err))
+		}
+	}
+	return nil
+}
+
+// readSchema reads the table's current definition on q, defaults included.
+func (s *Storage) readSchema(ctx context.Context, q execer, table string) (TableSchema, error) {
+	schema := TableSchema{Name: table}
+	var display, description sql.NullString
+	if err := q.QueryRowContext(ctx, `SELECT display_name, description FROM table_meta WHERE table_name=?`, table).
+		Scan(&display, &description); err != nil {
+		return schema, err
+	}
+	schema.DisplayName, schema.Description = display.String, description.String
+	fields, err := s.readColumns(ctx, q, table)
+	if err != nil {
+		return schema, err
+	}
+	decls, err := tableDecls(ctx, q, table)
+	if err != nil {
+		return schema, err
+	}
+	defaults := map[string]string{}
+	for _, d := range decls {
+		if d.dflt.Valid {
+			defaults[d.name] = unquoteDefault(d.dflt.String)
+		}
+	}
+	for i := range fields {
+		fields[i].Default = defaults[fields[i].Name]
+	}
+	schema.Fields = fields
+	return schema, nil
+}
+
+// recordSchema snapshots the table's definition after a schema change, on the
+// change's own transaction.
+func (s *Storage) recordSchema(ctx context.Context, q execer, action, table string) error {
+	schema, err := s.readSchema(ctx, q, table)
+	if err != nil {
+		return err
+	}
+	raw, err := json.Marshal(schema)
+	if err != nil {
+		return err
+	}
+	a := actorFrom(ctx)
+	if _, err := q.ExecContext(ctx, `INSERT INTO schema_versions(table_name, version, action, user_id, username, schema_json)
+		VALUES(?, (SELECT COALESCE(MAX(version),0)+1 FROM schema_versions WHERE table_name=?), ?, ?, ?, ?)`,
+		table, table, action, a.UserID, a.Username, string(raw)); err != nil {
+		s.l.Error("record schema version failed", zap.String("table", table), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// SchemaHistory lists all versions of a table's schema, oldest first. When at is
+// set, only the version in effect at that time is returned.
+func (s *Storage) SchemaHistory(ctx context.Context, table string, at string) ([]SchemaVersion, error) {
+	query := `SELECT version, action, COALESCE(username,''), strftime('%Y-%m-%d %H:%M:%S', ts), schema_json
+		FROM schema_versions WHERE table_name=?`
+	args := []any{table}
+	if at != "" {
+		ts, err := auditTime(at, true)
+		if err != nil {
+			return nil, err
+		}
+		query += ` AND ts<=? ORDER BY version DESC LIMIT 1`
+		args = append(args, ts)
+	} else {
+		query += ` ORDER BY version`
+	}
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	versions := []SchemaVersion{}
+	for rows.Next() {
+		var v SchemaVersion
+		var raw string
+		if err := rows.Scan(&v.Version, &v.Action, &v.Username, &v.Time, &raw); err != nil {
+			return nil, err
+		}
+		_ = json.Unmarshal([]byte(raw), &v.Schema)
+		versions = append(versions, v)
+	}
+	return versions, rows.Err()
+}
+
+func (s *Storage) SchemaVersionAt(ctx context.Context, table string, version int) (*SchemaVersion, error) {
+	var v SchemaVersion
+	var raw string
+	err := s.db.QueryRowContext(ctx, `SELECT version, action, COALESCE(username,''), strftime('%Y-%m-%d %H:%M:%S', ts), schema_json
+		FROM schema_versions WHERE table_name=? AND version=?`, table, version).
+		Scan(&v.Version, &v.Action, &v.Username, &v.Time, &raw)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("表 %s 不存在结构版本 %d", table, version)
+	}
+	if err != nil {
+		return nil, err
+	}
+	_ = json.Unmarshal([]byte(raw), &v.Schema)
+	return &v, nil
+}
+
+// DiffSchemaVersions compares two snapshots: table attributes first, then fields
+// in the order of the newer version, then fields that were removed. Fields are
+// matched by name, so a renamed field shows as removed and added.
+func (s *Storage) DiffSchemaVersions(ctx context.Context, table string, from, to int) ([]SchemaChange, error) {
+	a, err := s.SchemaVersionAt(ctx, table, from)
+	if err != nil {
+		return nil, err
+	}
+	b, err := s.SchemaVersionAt(ctx, table, to)
+	if err != nil {
+		return nil, err
+	}
+	changes := []SchemaChange{}
+	for _, attr := range []struct {
+		name     string
+		from, to string
+	}{
+		{"name", a.Schema.Name, b.Schema.Name},
+		{"display_name", a.Schema.DisplayName, b.Schema.DisplayName},
+		{"description", a.Schema.Description, b.Schema.Description},
+	} {
+		if attr.from != attr.to {
+			changes = append(changes, SchemaChange{Change: "changed", Attribute: attr.name, From: attr.from, To: attr.to})
+		}
+	}
+	old := map[string]FieldDefinition{}
+	for _, f := range a.Schema.Fields {
+		old[f.Name] = f
+	}
+	seen := map[string]bool{}
+	for _, f := range b.Schema.Fields {
+		seen[f.Name] = true
+		prev, ok := old[f.Name]
+		if !ok {
+			changes = append(changes, SchemaChange{Field: f.Name, Change: "added", To: f})
+			continue
+		}
+		changes = append(changes, fieldChanges(prev, f)...)
+	}
+	for _, f := range a.Schema.Fields {
+		if !seen[f.Name] {
+			changes = append(changes, SchemaChange{Field: f.Name, Change: "removed", From: f})
+		}
+	}
+	return changes, nil
+}
+
+// fieldChanges lists the attributes that differ between two definitions of a
+// field, keyed by their JSON names.
+func fieldChanges(a, b FieldDefinition) []SchemaChange {
+	attrs := func(f FieldDefinition) map[string]any {
+		f.OldName = ""
+		raw, _ := json.Marshal(f)
+		m := map[string]any{}
+		_ = json.Unmarshal(raw, &m)
+		return m
+	}
+	before, after := attrs(a), attrs(b)
+	var changes []SchemaChange
+	for _, key := range []string{"labels", "type_hint", "allow_null", "default", "description", "options", "rules", "unique", "indexed"} {
+		if !reflect.DeepEqual(before[key], after[key]) {
+			changes = append(changes, SchemaChange{Field: b.Name, Change: "changed", Attribute: key, From: before[key], To: after[key]})
+		}
+	}
+	return changes
+}
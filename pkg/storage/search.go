@@ -0,0 +1,267 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"go.uber.org/zap"
+)
+
+// Every user table gets an external-content FTS5 index named <table>_fts over its
+// TEXT columns, kept in sync by triggers. The trigram tokenizer is used because it
+// matches Chinese text (which has no word boundaries) as well as Latin words, at
+// the cost of needing at least three characters per search term.
+
+const ftsMinTermRunes = 3
+
+func ftsName(table string) string {
+	return table + "_fts"
+}
+
+// ensureSearch builds the index for tables created before full-text search existed.
+func (s *Storage) ensureSearch() error {
+	ctx := context.Background()
+	rows, err := s.db.QueryContext(ctx, `SELECT table_name FROM table_meta`)
+	if err != nil {
+		return err
+	}
+	var tables []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return err
+		}
+		tables = append(tables, name)
+	}
+	rows.Close()
+	for _, t := range tables {
+		if s.hasFTS(ctx, s.db, t) {
+			continue
+		}
+		if err := s.rebuildFTS(ctx, s.db, t); err != nil {
+			s.l.Error("build fts index failed", zap.String("table", t), zap.Error(err))
+		}
+	}
+	return nil
+}
+
+func (s *Storage) hasFTS(ctx context.Context, q execer, table string) bool {
+	var n int
+	_ = q.QueryRowContext(ctx, `SELECT COUNT(1) FROM sqlite_master WHERE type='table' AND name=?`, ftsName(table)).Scan(&n)
+	return n > 0
+}
+
+func (s *Storage) dropFTS(ctx context.Context, q execer, table string) error {
+	fts := ftsName(table)
+	for _, stmt := range []string{
+		"DROP TRIGGER IF EXISTS " + quoteIdent(fts+"_ai"),
+		"DROP TRIGGER IF EXISTS " + quoteIdent(fts+"_ad"),
+		"DROP TRIGGER IF EXISTS " + quoteIdent(fts+"_au"),
+		"DROP TABLE IF EXISTS " + quoteIdent(fts),
+	} {
+		if _, err := q.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rebuildFTS recreates the index and its triggers from the table's current TEXT
+// columns. It must run after every schema change that touches columns or names.
+func (s *Storage) rebuildFTS(ctx context.Context, q execer, table string) error {
+	if err := s.dropFTS(ctx, q, table); err != nil {
+		return err
+	}
+	cols, err := textColumns(ctx, q, table)
+	if err != nil {
+		return err
+	}
+	if len(cols) == 0 {
+		return nil
+	}
+	name := ftsName(table)
+	fts, tbl := quoteIdent(name), quoteIdent(table)
+	quoted := quoteAll(cols)
+	list := strings.Join(quoted, ", ")
+	newVals := "new." + strings.Join(quoted, ", new.")
+	oldVals := "old." + strings.Join(quoted, ", old.")
+	stmts := []string{
+		fmt.Sprintf("CREATE VIRTUAL TABLE %s USING fts5(%s, content='%s', content_rowid='id', tokenize='trigram')",
+			fts, list, strings.ReplaceAll(table, "'", "''")),
+		fmt.Sprintf("CREATE TRIGGER %s AFTER INSERT ON %s BEGIN INSERT INTO %s(rowid, %s) VALUES (new.id, %s); END",
+			quoteIdent(name+"_ai"), tbl, fts, list, newVals),
+		fmt.Sprintf("CREATE TRIGGER %s AFTER DELETE ON %s BEGIN INSERT INTO %s(%s, rowid, %s) VALUES ('delete', old.id, %s); END",
+			quoteIdent(name+"_ad"), tbl, fts, fts, list, oldVals),
+		fmt.Sprintf("CREATE TRIGGER %s AFTER UPDATE ON %s BEGIN INSERT INTO %s(%s, rowid, %s) VALUES ('delete', old.id, %s); INSERT INTO %s(rowid, %s) VALUES (new.id, %s); END",
+			quoteIdent(name+"_au"), tbl, fts, fts, list, oldVals, fts, list, newVals),
+		fmt.Sprintf("INSERT INTO %s(%s) VALUES ('rebuild')", fts, fts),
+	}
+	for _, stmt := range stmts {
+		if _, err := q.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// textColumns returns the user columns declared TEXT, which are the ones indexed.
+func textColumns(ctx context.Context, q execer, table string) ([]string, error) {
+	rows, err := q.QueryContext(ctx, `SELECT name, type FROM pragma_table_info(?)`, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var cols []string
+	for rows.Next() {
+		var name, ctype string
+		if err := rows.Scan(&name, &ctype); err != nil {
+			return nil, err
+		}
+		if isSystemColumn(name) || !strings.EqualFold(ctype, "TEXT") {
+			continue
+		}
+		cols = append(cols, name)
+	}
+	return cols, rows.Err()
+}
+
+// ftsQuery turns user input into an FTS5 MATCH expression: "quoted text" is a
+// phrase, a trailing * marks a prefix (already implied by trigram substring
+// matching) and separate terms must all match. ok is false when some term is too
+// short for the trigram index, in which case callers fall back to LIKE.
+func ftsQuery(search string) (string, bool) {
+	var terms []string
+	rest := strings.TrimSpace(search)
+	for rest != "" {
+		var term string
+		if rest[0] == '"' {
+			end := strings.IndexByte(rest[1:], '"')
+			if end < 0 {
+				term, rest = rest[1:], ""
+			} else {
+				term, rest = rest[1:end+1], rest[end+2:]
+			}
+		} else {
+			end := strings.IndexAny(rest, " \t　")
+			if end < 0 {
+				term, rest = rest, ""
+			} else {
+				term, rest = rest[:end], rest[end:]
+			}
+			term = strings.TrimSuffix(term, "*")
+		}
+		rest = strings.TrimLeft(rest, " \t　")
+		term = strings.TrimSpace(term)
+		if term == "" {
+			continue
+		}
+		if utf8.RuneCountInString(term) < ftsMinTermRunes {
+			return "", false
+		}
+		terms = append(terms, `"`+strings.ReplaceAll(term, `"`, `""`)+`"`)
+	}
+	if len(terms) == 0 {
+		return "", false
+	}
+	return strings.Join(terms, " "), true
+}
+
+// searchPlan restricts a query to full-text hits via a CTE join and exposes the
+// bm25 rank for ordering. Only TEXT columns are indexed, so when the table has
+// other columns the join is a LEFT JOIN and cond ORs the hit with LIKE on those
+// columns; rows found only by LIKE rank after every index hit.
+type searchPlan struct {
+	with       string
+	join       string
+	rank       string
+	order      string
+	params     []any
+	cond       string
+	condParams []any
+}
+
+// apply adds the plan's condition to a WHERE clause built by buildFilters and
+// orders the parameters to match the final statement.
+func (p *searchPlan) apply(where string, params []any) (string, []any) {
+	out := append(append([]any{}, p.params...), params...)
+	if p.cond == "" {
+		return where, out
+	}
+	return where + " AND " + p.cond, append(out, p.condParams...)
+}
+
+// planSearch returns nil when the table has no index or the input cannot use it.
+func (s *Storage) planSearch(ctx context.Context, table, search string) *searchPlan {
+	if strings.TrimSpace(search) == "" || !s.hasFTS(ctx, s.db, table) {
+		return nil
+	}
+	match, ok := ftsQuery(search)
+	if !ok {
+		return nil
+	}
+	fts := quoteIdent(ftsName(table))
+	plan := &searchPlan{
+		with:   fmt.Sprintf("WITH fts_hits AS (SELECT rowid AS hit_id, rank AS hit_rank FROM %s WHERE %s MATCH ?) ", fts, fts),
+		join:   " JOIN fts_hits ON fts_hits.hit_id = " + qualify(table, "id"),
+		rank:   "fts_hits.hit_rank",
+		params: []any{match},
+	}
+	others, err := s.unindexedColumns(ctx, table)
+	if err != nil {
+		s.l.Error("list unindexed columns failed", zap.String("table", table), zap.Error(err))
+	}
+	if len(others) > 0 {
+		parts := []string{"fts_hits.hit_id IS NOT NULL"}
+		for _, col := range others {
+			parts = append(parts, qualify(table, col)+" LIKE ?")
+			plan.condParams = append(plan.condParams, "%"+search+"%")
+		}
+		plan.join = " LEFT" + plan.join
+		plan.rank = "COALESCE(fts_hits.hit_rank, 0)"
+		plan.cond = "(" + strings.Join(parts, " OR ") + ")"
+	}
+	plan.order = "ORDER BY " + plan.rank
+	return plan
+}
+
+// unindexedColumns returns the user columns the index does not cover.
+func (s *Storage) unindexedColumns(ctx context.Context, table string) ([]string, error) {
+	columns, err := s.tableColumns(ctx, table)
+	if err != nil {
+		return nil, err
+	}
+	indexed, err := textColumns(ctx, s.db, table)
+	if err != nil {
+		return nil, err
+	}
+	var cols []string
+	for _, col := range columns {
+		if !slices.Contains(indexed, col) {
+			cols = append(cols, col)
+		}
+	}
+	return cols, nil
+}
+
+// ftsColumns returns the columns the table's index currently covers (none when
+// there is no index).
+func ftsColumns(ctx context.Context, q execer, table string) ([]string, error) {
+	rows, err := q.QueryContext(ctx, `SELECT name FROM pragma_table_info(?)`, ftsName(table))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var cols []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		cols = append(cols, name)
+	}
+	return cols, rows.Err()
+}
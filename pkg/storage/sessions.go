@@ -0,0 +1,104 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var ErrSessionInvalid = errors.New("登录已失效，请重新登录")
+
+// Sessions are opaque random tokens; only their SHA-256 is stored so a leaked
+// database cannot be replayed as live logins.
+func (s *Storage) ensureSessions() error {
+	ddl := []string{
+		`CREATE TABLE IF NOT EXISTS sessions (
+			token_hash TEXT PRIMARY KEY,
+			user_id INTEGER NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			expires_at INTEGER NOT NULL,
+			revoked INTEGER DEFAULT 0
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_sessions_user ON sessions(user_id);`,
+	}
+	for _, stmt := range ddl {
+		if _, err := s.db.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Storage) CreateSession(ctx context.Context, userID int64, ttl time.Duration) (string, time.Time, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", time.Time{}, err
+	}
+	token := hex.EncodeToString(buf)
+	expires := time.Now().Add(ttl)
+	if _, err := s.db.ExecContext(ctx, `INSERT INTO sessions(token_hash, user_id, expires_at) VALUES(?,?,?)`,
+		hashToken(token), userID, expires.Unix()); err != nil {
+		s.l.Error("create session failed", zap.Int64("user", userID), zap.Error(err))
+		return "", time.Time{}, err
+	}
+	// Opportunistically drop long-dead sessions.
+	_, _ = s.db.ExecContext(ctx, `DELETE FROM sessions WHERE expires_at < ?`, time.Now().Add(-7*24*time.Hour).Unix())
+	return token, expires, nil
+}
+
+// SessionUser resolves a token to its user, rejecting expired, revoked or disabled ones.
+func (s *Storage) SessionUser(ctx context.Context, token string) (*User, error) {
+	var u User
+	var expires int64
+	var revoked bool
+	err := s.db.QueryRowContext(ctx, `SELECT u.id, u.username, COALESCE(u.display_name,''), u.role, u.disabled, u.created_at, u.updated_at, s.expires_at, s.revoked
+		FROM sessions s JOIN users u ON u.id=s.user_id WHERE s.token_hash=?`, hashToken(token)).
+		Scan(&u.ID, &u.Username, &u.DisplayName, &u.Role, &u.Disabled, &u.CreatedAt, &u.UpdatedAt, &expires, &revoked)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrSessionInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	if revoked || u.Disabled || time.Now().Unix() >= expires {
+		return nil, ErrSessionInvalid
+	}
+	return &u, nil
+}
+
+// RefreshSession rotates a still-valid token into a new one with a fresh expiry.
+func (s *Storage) RefreshSession(ctx context.Context, token string, ttl time.Duration) (string, time.Time, error) {
+	u, err := s.SessionUser(ctx, token)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	if err := s.RevokeSession(ctx, token); err != nil {
+		return "", time.Time{}, err
+	}
+	return s.CreateSession(ctx, u.ID, ttl)
+}
+
+func (s *Storage) RevokeSession(ctx context.Context, token string) error {
+	_, err := s.db.ExecContext(ctx, `UPDATE sessions SET revoked=1 WHERE token_hash=?`, hashToken(token))
+	return err
+}
+
+func (s *Storage) RevokeUserSessions(ctx context.Context, userID int64) (int64, error) {
+	res, err := s.db.ExecContext(ctx, `UPDATE sessions SET revoked=1 WHERE user_id=? AND revoked=0`, userID)
+	if err != nil {
+		s.l.Error("revoke sessions failed", zap.Int64("user", userID), zap.Error(err))
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
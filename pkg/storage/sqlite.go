@@ -29,6 +29,15 @@ type FieldDefinition struct {
 	TypeHint  string   `json:"type_hint"`
 	AllowNull bool     `json:"allow_null"`
 	Default   string   `json:"default"`
+	// Description explains the field in the data dictionary.
+	Description string `json:"description,omitempty"`
+	// Options lists the allowed values of enum/multi fields.
+	Options []FieldOption `json:"options,omitempty"`
+	// Rules are checked on every insert, update and import.
+	Rules *FieldRules `json:"rules,omitempty"`
+	// Unique and Indexed are backed by SQLite indexes, see syncIndexes.
+	Unique  bool `json:"unique,omitempty"`
+	Indexed bool `json:"indexed,omitempty"`
 }
 
 type TableSchema struct {
@@ -41,10 +50,16 @@ type TableSchema struct {
 type QueryOptions struct {
 	Search   string            `json:"search"`
 	Filters  map[string]string `json:"filters"`
+	Where    *FilterNode       `json:"where,omitempty"`
+	Columns  []string          `json:"columns,omitempty"`
 	Page     int               `json:"page"`
 	PageSize int               `json:"page_size"`
 	SortBy   string            `json:"sort_by"`
 	Desc     bool              `json:"desc"`
+	// Cursor is the NextCursor of the previous page; when set, Page is ignored.
+	Cursor string `json:"cursor,omitempty"`
+	// SkipTotal avoids the COUNT(1) on large tables.
+	SkipTotal bool `json:"skip_total,omitempty"`
 }
 
 type Storage struct {
@@ -111,7 +126,49 @@ func (s *Storage) ensureMeta() error {
 	if count == 0 {
 		_, _ = s.db.Exec(`ALTER TABLE column_meta ADD COLUMN allow_null INTEGER DEFAULT 1`)
 	}
-	return nil
+	for _, col := range [][2]string{
+		{"options", "TEXT"},
+		{"rules", "TEXT"},
+		{"is_unique", "INTEGER DEFAULT 0"},
+		{"is_indexed", "INTEGER DEFAULT 0"},
+		{"description", "TEXT"},
+	} {
+		count = 0
+		_ = s.db.QueryRow(`SELECT COUNT(1) FROM pragma_table_info('column_meta') WHERE name=?`, col[0]).Scan(&count)
+		if count == 0 {
+			if _, err := s.db.Exec(`ALTER TABLE column_meta ADD COLUMN ` + col[0] + ` ` + col[1]); err != nil {
+				return err
+			}
+		}
+	}
+	if err := s.ensureUsers(); err != nil {
+		return err
+	}
+	if err := s.ensureSessions(); err != nil {
+		return err
+	}
+	if err := s.ensureAudit(); err != nil {
+		return err
+	}
+	if err := s.ensureHistory(); err != nil {
+		return err
+	}
+	if err := s.ensureSoftDelete(); err != nil {
+		return err
+	}
+	if err := s.ensureSearch(); err != nil {
+		return err
+	}
+	if err := s.ensureViews(); err != nil {
+		return err
+	}
+	if err := s.ensureGrants(); err != nil {
+		return err
+	}
+	if err := s.ensureIndexes(); err != nil {
+		return err
+	}
+	return s.ensureSchemaVersions()
 }
 
 func (s *Storage) CreateTable(ctx context.Context, schema TableSchema) error {
@@ -125,7 +182,24 @@ func (s *Storage) CreateTable(ctx context.Context, schema TableSchema) error {
 		s.l.Error("create table validation failed", zap.Error(err))
 		return err
 	}
+	if err := checkTableName(schema.Name); err != nil {
+		return err
+	}
+	for _, f := range schema.Fields {
+		if err := checkFieldName(f.Name); err != nil {
+			return err
+		}
+	}
 	s.l.Info("create table", zap.String("name", schema.Name), zap.Int("fields", len(schema.Fields)))
+	var deleted int
+	_ = s.db.QueryRowContext(ctx, `SELECT COUNT(1) FROM table_meta WHERE table_name=? AND deleted_at IS NOT NULL`, schema.Name).Scan(&deleted)
+	if deleted > 0 {
+		return fmt.Errorf("回收站中存在同名表 %s，请先恢复或清除", schema.Name)
+	}
+	names := make([]string, 0, len(schema.Fields))
+	for _, f := range schema.Fields {
+		names = append(names, f.Name)
+	}
 	var columns []string
 	columns = append(columns, "id INTEGER PRIMARY KEY AUTOINCREMENT")
 	for _, f := range schema.Fields {
@@ -135,7 +209,10 @@ func (s *Storage) CreateTable(ctx context.Context, schema TableSchema) error {
 			s.l.Error("create table type map failed", zap.String("column", f.Name), zap.Error(err))
 			return err
 		}
-		col := fmt.Sprintf("%s %s", f.Name, sqlType)
+		if err := validateField(f, names); err != nil {
+			return err
+		}
+		col := fmt.Sprintf("%s %s", quoteIdent(f.Name), sqlType)
 		if !f.AllowNull {
 			col += " NOT NULL"
 		}
@@ -147,28 +224,42 @@ func (s *Storage) CreateTable(ctx context.Context, schema TableSchema) error {
 	columns = append(columns,
 		"created_at DATETIME DEFAULT CURRENT_TIMESTAMP",
 		"updated_at DATETIME DEFAULT CURRENT_TIMESTAMP",
+		"deleted_at DATETIME",
 	)
-	ddl := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s);", schema.Name, strings.Join(columns, ","))
-	if _, err := s.db.ExecContext(ctx, ddl); err != nil {
+	ddl := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s);", quoteIdent(schema.Name), strings.Join(columns, ","))
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, ddl); err != nil {
 		s.l.Error("create table ddl failed", zap.String("table", schema.Name), zap.Error(err))
 		return err
 	}
-
-	if err := s.upsertMeta(schema); err != nil {
+	if err := s.rebuildFTS(ctx, tx, schema.Name); err != nil {
+		s.l.Error("create fts index failed", zap.String("table", schema.Name), zap.Error(err))
+		return err
+	}
+	if err := s.createIndexes(ctx, tx, schema.Name, schema.Fields); err != nil {
+		s.l.Error("create indexes failed", zap.String("table", schema.Name), zap.Error(err))
+		return err
+	}
+	if err := s.writeMeta(ctx, tx, schema); err != nil {
 		s.l.Error("upsert meta failed", zap.String("table", schema.Name), zap.Error(err))
 		return err
 	}
-	return nil
-}
-
-func (s *Storage) upsertMeta(schema TableSchema) error {
-	tx, err := s.db.Begin()
-	if err != nil {
-		s.l.Error("upsert meta begin tx failed", zap.Error(err))
+	if err := s.recordSchema(ctx, tx, AuditCreateTable, schema.Name); err != nil {
 		return err
 	}
-	defer tx.Rollback()
-	_, err = tx.Exec(`INSERT INTO table_meta(table_name, display_name, description)
+	if err := s.audit(ctx, tx, AuditCreateTable, schema.Name, 0, nil, schema); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// writeMeta replaces the table's table_meta and column_meta rows with schema.
+func (s *Storage) writeMeta(ctx context.Context, q execer, schema TableSchema) error {
+	_, err := q.ExecContext(ctx, `INSERT INTO table_meta(table_name, display_name, description)
 		VALUES(?,?,?)
 		ON CONFLICT(table_name) DO UPDATE SET display_name=excluded.display_name, description=excluded.description`,
 		schema.Name, schema.DisplayName, schema.Description)
@@ -177,26 +268,27 @@ func (s *Storage) upsertMeta(schema TableSchema) error {
 		return err
 	}
 	// Clear existing column meta
-	if _, err := tx.Exec(`DELETE FROM column_meta WHERE table_name=?`, schema.Name); err != nil {
+	if _, err := q.ExecContext(ctx, `DELETE FROM column_meta WHERE table_name=?`, schema.Name); err != nil {
 		s.l.Error("delete column_meta failed", zap.String("table", schema.Name), zap.Error(err))
 		return err
 	}
 	for i, f := range schema.Fields {
 		labels, _ := json.Marshal(f.Labels)
-		if _, err := tx.Exec(`INSERT INTO column_meta(table_name, column_name, labels, type_hint, allow_null, display_order)
-			VALUES(?,?,?,?,?,?)`, schema.Name, f.Name, string(labels), f.TypeHint, boolToInt(f.AllowNull), i); err != nil {
+		if _, err := q.ExecContext(ctx, `INSERT INTO column_meta(table_name, column_name, labels, type_hint, allow_null, display_order, options, rules, is_unique, is_indexed, description)
+			VALUES(?,?,?,?,?,?,?,?,?,?,?)`, schema.Name, f.Name, string(labels), f.TypeHint, boolToInt(f.AllowNull), i, optionsJSON(f.Options), rulesJSON(f.Rules),
+			boolToInt(f.Unique), boolToInt(f.Indexed), f.Description); err != nil {
 			s.l.Error("insert column_meta failed", zap.String("table", schema.Name), zap.String("column", f.Name), zap.Error(err))
 			return err
 		}
 	}
 	s.l.Info("upsert meta done", zap.String("table", schema.Name), zap.Int("fields", len(schema.Fields)))
-	return tx.Commit()
+	return nil
 }
 
 func (s *Storage) ListTables(ctx context.Context) ([]TableSchema, error) {
 	start := time.Now()
 	s.l.Info("list tables start")
-	rows, err := s.db.QueryContext(ctx, `SELECT table_name, display_name, description FROM table_meta ORDER BY table_name`)
+	rows, err := s.db.QueryContext(ctx, `SELECT table_name, display_name, description FROM table_meta WHERE deleted_at IS NULL ORDER BY table_name`)
 	if err != nil {
 		s.l.Error("list tables meta failed", zap.Error(err))
 		return nil, err
@@ -222,8 +314,15 @@ func (s *Storage) ListTables(ctx context.Context) ([]TableSchema, error) {
 }
 
 func (s *Storage) listColumns(ctx context.Context, table string) ([]FieldDefinition, error) {
+	return s.readColumns(ctx, s.db, table)
+}
+
+// readColumns is listColumns on a given connection, so schema changes can see
+// their own uncommitted metadata.
+func (s *Storage) readColumns(ctx context.Context, q execer, table string) ([]FieldDefinition, error) {
 	start := time.Now()
-	rows, err := s.db.QueryContext(ctx, `SELECT column_name, labels, type_hint, allow_null FROM column_meta WHERE table_name=? ORDER BY display_order`, table)
+	rows, err := q.QueryContext(ctx, `SELECT column_name, labels, type_hint, allow_null, COALESCE(options,''), COALESCE(rules,''),
+		COALESCE(is_unique,0), COALESCE(is_indexed,0), COALESCE(description,'') FROM column_meta WHERE table_name=? ORDER BY display_order`, table)
 	if err != nil {
 		s.l.Error("query column_meta failed", zap.String("table", table), zap.Error(err))
 		return nil, err
@@ -232,12 +331,18 @@ func (s *Storage) listColumns(ctx context.Context, table string) ([]FieldDefinit
 	var fields []FieldDefinition
 	for rows.Next() {
 		var f FieldDefinition
-		var labels string
-		if err := rows.Scan(&f.Name, &labels, &f.TypeHint, &f.AllowNull); err != nil {
+		var labels, options, rules string
+		if err := rows.Scan(&f.Name, &labels, &f.TypeHint, &f.AllowNull, &options, &rules, &f.Unique, &f.Indexed, &f.Description); err != nil {
 			s.l.Error("scan column_meta failed", zap.String("table", table), zap.Error(err))
 			return nil, err
 		}
 		_ = json.Unmarshal([]byte(labels), &f.Labels)
+		if options != "" {
+			_ = json.Unmarshal([]byte(options), &f.Options)
+		}
+		if rules != "" {
+			_ = json.Unmarshal([]byte(rules), &f.Rules)
+		}
 		fields = append(fields, f)
 	}
 	s.l.Info("list columns done", zap.String("table", table), zap.Int("count", len(fields)), zap.Duration("cost", time.Since(start)))
@@ -245,40 +350,82 @@ func (s *Storage) listColumns(ctx context.Context, table string) ([]FieldDefinit
 }
 
 func (s *Storage) AddColumns(ctx context.Context, table string, fields []FieldDefinition) error {
+	if err := s.CheckTable(ctx, table); err != nil {
+		return err
+	}
+	names, err := s.tableColumns(ctx, table)
+	if err != nil {
+		return err
+	}
+	for _, f := range fields {
+		if err := checkFieldName(f.Name); err != nil {
+			return err
+		}
+		if slices.Contains(names, f.Name) {
+			return fmt.Errorf("字段 %s 已存在", f.Name)
+		}
+		names = append(names, f.Name)
+	}
+	for _, f := range fields {
+		if err := validateField(f, names); err != nil {
+			return err
+		}
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := s.addColumns(ctx, tx, table, fields); err != nil {
+		return err
+	}
+	if err := s.recordSchema(ctx, tx, AuditAddColumns, table); err != nil {
+		return err
+	}
+	if err := s.audit(ctx, tx, AuditAddColumns, table, 0, nil, fields); err != nil {
+		return err
+	}
+	if err := s.rebuildFTS(ctx, tx, table); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// addColumns adds validated fields and their metadata and indexes.
+func (s *Storage) addColumns(ctx context.Context, q execer, table string, fields []FieldDefinition) error {
 	for _, f := range fields {
 		sqlType := mapType(f.TypeHint)
-		stmt := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, f.Name, sqlType)
+		stmt := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", quoteIdent(table), quoteIdent(f.Name), sqlType)
 		if !f.AllowNull {
 			stmt += " NOT NULL"
 		}
 		if f.Default != "" {
 			stmt += " DEFAULT '" + strings.ReplaceAll(f.Default, "'", "''") + "'"
 		}
-		if _, err := s.db.ExecContext(ctx, stmt); err != nil {
+		if _, err := q.ExecContext(ctx, stmt); err != nil {
 			return err
 		}
 	}
 	order := 0
-	_ = s.db.QueryRowContext(ctx, `SELECT COALESCE(MAX(display_order),0) FROM column_meta WHERE table_name=?`, table).Scan(&order)
-	tx, err := s.db.BeginTx(ctx, nil)
-	if err != nil {
-		return err
-	}
+	_ = q.QueryRowContext(ctx, `SELECT COALESCE(MAX(display_order),0) FROM column_meta WHERE table_name=?`, table).Scan(&order)
 	for i, f := range fields {
 		labels, _ := json.Marshal(f.Labels)
-		if _, err := tx.Exec(`INSERT INTO column_meta(table_name, column_name, labels, type_hint, allow_null, display_order)
-			VALUES(?,?,?,?,?,?)`, table, f.Name, string(labels), f.TypeHint, boolToInt(f.AllowNull), order+i+1); err != nil {
-			tx.Rollback()
+		if _, err := q.ExecContext(ctx, `INSERT INTO column_meta(table_name, column_name, labels, type_hint, allow_null, display_order, options, rules, is_unique, is_indexed, description)
+			VALUES(?,?,?,?,?,?,?,?,?,?,?)`, table, f.Name, string(labels), f.TypeHint, boolToInt(f.AllowNull), order+i+1, optionsJSON(f.Options), rulesJSON(f.Rules),
+			boolToInt(f.Unique), boolToInt(f.Indexed), f.Description); err != nil {
 			return err
 		}
 	}
-	return tx.Commit()
+	return s.createIndexes(ctx, q, table, fields)
 }
 
 func (s *Storage) DropColumns(ctx context.Context, table string, columns []string) error {
 	if len(columns) == 0 {
 		return nil
 	}
+	if err := s.CheckTable(ctx, table); err != nil {
+		return err
+	}
 	current, err := s.tableColumns(ctx, table)
 	if err != nil {
 		return err
@@ -292,50 +439,67 @@ func (s *Storage) DropColumns(ctx context.Context, table string, columns []strin
 	if len(keep) == len(current) {
 		return nil
 	}
-	tmp := table + "_tmp_" + fmt.Sprint(time.Now().Unix())
-	var colDDL []string
-	colDDL = append(colDDL, "id INTEGER PRIMARY KEY AUTOINCREMENT")
-	for _, c := range keep {
-		colDDL = append(colDDL, fmt.Sprintf("%s TEXT", c))
-	}
-	colDDL = append(colDDL, "created_at DATETIME", "updated_at DATETIME")
-	ddl := fmt.Sprintf("CREATE TABLE %s (%s);", tmp, strings.Join(colDDL, ","))
 	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
-	if _, err := tx.Exec(ddl); err != nil {
-		tx.Rollback()
+	defer tx.Rollback()
+	if err := s.dropColumns(ctx, tx, table, columns); err != nil {
 		return err
 	}
-	copyCols := append([]string{"id"}, keep...)
-	copyCols = append(copyCols, "created_at", "updated_at")
-	cols := strings.Join(copyCols, ",")
-	if _, err := tx.Exec(fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM %s;", tmp, cols, cols, table)); err != nil {
-		tx.Rollback()
+	if err := s.recordSchema(ctx, tx, AuditDropColumns, table); err != nil {
 		return err
 	}
-	if _, err := tx.Exec("DROP TABLE " + table); err != nil {
-		tx.Rollback()
+	if err := s.audit(ctx, tx, AuditDropColumns, table, 0, columns, nil); err != nil {
 		return err
 	}
-	if _, err := tx.Exec("ALTER TABLE " + tmp + " RENAME TO " + table); err != nil {
-		tx.Rollback()
+	return tx.Commit()
+}
+
+// dropColumns rebuilds the table without columns, keeping every other column's
+// declaration, and removes their metadata.
+func (s *Storage) dropColumns(ctx context.Context, q execer, table string, columns []string) error {
+	meta, err := s.readColumns(ctx, q, table)
+	if err != nil {
+		return err
+	}
+	kept := slices.DeleteFunc(meta, func(f FieldDefinition) bool { return slices.Contains(columns, f.Name) })
+	decls, err := tableDecls(ctx, q, table)
+	if err != nil {
 		return err
 	}
-	if err := tx.Commit(); err != nil {
+	decls = slices.DeleteFunc(decls, func(d columnDecl) bool { return slices.Contains(columns, d.name) && !isSystemColumn(d.name) })
+	if err := s.rebuildTable(ctx, q, table, decls, kept); err != nil {
 		return err
 	}
-	// Clean column meta
-	q := fmt.Sprintf("DELETE FROM column_meta WHERE table_name=? AND column_name IN (%s)", placeholders(len(columns)))
-	args := append([]any{table}, toAny(columns)...)
-	_, err = s.db.Exec(q, args...)
+	stmt := fmt.Sprintf("DELETE FROM column_meta WHERE table_name=? AND column_name IN (%s)", placeholders(len(columns)))
+	_, err = q.ExecContext(ctx, stmt, append([]any{table}, toAny(columns)...)...)
 	return err
 }
 
 func (s *Storage) ClearTable(ctx context.Context, table string) error {
-	_, err := s.db.ExecContext(ctx, "DELETE FROM "+table)
-	return err
+	if err := s.CheckTable(ctx, table); err != nil {
+		return err
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	rows, err := selectRows(ctx, tx, "SELECT * FROM "+quoteIdent(table)+" WHERE deleted_at IS NULL")
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE "+quoteIdent(table)+" SET deleted_at=CURRENT_TIMESTAMP WHERE deleted_at IS NULL"); err != nil {
+		return err
+	}
+	if err := s.auditRows(ctx, tx, AuditClear, table, rows); err != nil {
+		return err
+	}
+	if err := s.recordVersions(ctx, tx, AuditClear, table, rows); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 func (s *Storage) tableDisplayName(ctx context.Context, table string) string {
@@ -346,46 +510,144 @@ func (s *Storage) tableDisplayName(ctx context.Context, table string) string {
 	return name
 }
 
+// DropTable moves the table to the recycle bin; its data stays until Purge.
 func (s *Storage) DropTable(ctx context.Context, table string) error {
-	if _, err := s.db.ExecContext(ctx, "DROP TABLE IF EXISTS "+table); err != nil {
+	if err := s.CheckTable(ctx, table); err != nil {
+		return err
+	}
+	fields, err := s.listColumns(ctx, table)
+	if err != nil {
 		return err
 	}
-	if _, err := s.db.ExecContext(ctx, "DELETE FROM table_meta WHERE table_name=?", table); err != nil {
+	before := TableSchema{Name: table, DisplayName: s.tableDisplayName(ctx, table), Fields: fields}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	res, err := tx.ExecContext(ctx, "UPDATE table_meta SET deleted_at=CURRENT_TIMESTAMP WHERE table_name=? AND deleted_at IS NULL", table)
+	if err != nil {
 		return err
 	}
-	if _, err := s.db.ExecContext(ctx, "DELETE FROM column_meta WHERE table_name=?", table); err != nil {
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("表 %s 不存在", table)
+	}
+	if err := s.audit(ctx, tx, AuditDropTable, table, 0, before, nil); err != nil {
 		return err
 	}
-	return nil
+	return tx.Commit()
 }
 
 func (s *Storage) UpdateColumns(ctx context.Context, table string, fields []FieldDefinition) error {
+	if err := s.CheckTable(ctx, table); err != nil {
+		return err
+	}
+	before, err := s.listColumns(ctx, table)
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(before))
+	for _, f := range before {
+		names = append(names, f.Name)
+	}
+	for _, f := range fields {
+		if err := validateField(f, names); err != nil {
+			return err
+		}
+	}
 	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
+	// A changed type converts the stored values like UpdateTable does.
+	for i, f := range fields {
+		idx := slices.IndexFunc(before, func(b FieldDefinition) bool { return b.Name == f.Name })
+		if idx < 0 {
+			continue
+		}
+		if f.TypeHint == "" {
+			fields[i].TypeHint = before[idx].TypeHint
+			continue
+		}
+		if strings.EqualFold(f.TypeHint, before[idx].TypeHint) {
+			continue
+		}
+		if err := s.convertForUpdate(ctx, tx, table, ConvertRequest{Column: f.Name, TypeHint: f.TypeHint, Options: f.Options, Rules: f.Rules}); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
 	for _, f := range fields {
 		labels, _ := json.Marshal(f.Labels)
-		if _, err := tx.Exec(`UPDATE column_meta SET labels=?, type_hint=?, allow_null=? WHERE table_name=? AND column_name=?`,
-			string(labels), f.TypeHint, boolToInt(f.AllowNull), table, f.Name); err != nil {
+		if _, err := tx.Exec(`UPDATE column_meta SET labels=?, type_hint=?, allow_null=?, options=?, rules=?, is_unique=?, is_indexed=?, description=? WHERE table_name=? AND column_name=?`,
+			string(labels), f.TypeHint, boolToInt(f.AllowNull), optionsJSON(f.Options), rulesJSON(f.Rules), boolToInt(f.Unique), boolToInt(f.Indexed), f.Description, table, f.Name); err != nil {
 			tx.Rollback()
 			return err
 		}
 	}
+	if err := s.applyNullability(ctx, tx, table); err != nil {
+		tx.Rollback()
+		return err
+	}
+	merged := slices.Clone(before)
+	for i, old := range merged {
+		for _, f := range fields {
+			if f.Name == old.Name {
+				merged[i] = f
+			}
+		}
+	}
+	if err := s.syncIndexes(ctx, tx, table, merged); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := s.recordSchema(ctx, tx, AuditUpdateColumns, table); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := s.audit(ctx, tx, AuditUpdateColumns, table, 0, before, fields); err != nil {
+		tx.Rollback()
+		return err
+	}
 	return tx.Commit()
 }
 
+// convertForUpdate applies a type change made by editing the table's fields and
+// names the first value that does not convert.
+func (s *Storage) convertForUpdate(ctx context.Context, tx execer, table string, conv ConvertRequest) error {
+	report, err := s.convertColumn(ctx, tx, table, conv)
+	if err != nil && report != nil && len(report.Issues) > 0 {
+		return &ConvertError{Report: report}
+	}
+	return err
+}
+
 // UpdateTable updates table name and column definitions (rename/add/drop, labels, allow_null).
-// It does not allow changing existing column types to avoid destructive migrations.
+// A changed type is applied with ConvertColumn and refused if any value would not convert;
+// a changed allow_null rebuilds the table with the matching NOT NULL constraint.
 func (s *Storage) UpdateTable(ctx context.Context, table string, schema TableSchema) error {
 	if schema.Name == "" {
 		schema.Name = table
 	}
+	if err := s.CheckTable(ctx, table); err != nil {
+		return err
+	}
+	if schema.Name != table {
+		if err := checkTableName(schema.Name); err != nil {
+			return err
+		}
+		var taken int
+		_ = s.db.QueryRowContext(ctx, `SELECT COUNT(1) FROM table_meta WHERE table_name=?`, schema.Name).Scan(&taken)
+		if taken > 0 {
+			return fmt.Errorf("表 %s 已存在", schema.Name)
+		}
+	}
 
 	existingFields, err := s.listColumns(ctx, table)
 	if err != nil {
 		return err
 	}
+	before := TableSchema{Name: table, DisplayName: s.tableDisplayName(ctx, table), Fields: existingFields}
 	existingMap := map[string]FieldDefinition{}
 	for _, f := range existingFields {
 		existingMap[f.Name] = f
@@ -396,6 +658,7 @@ func (s *Storage) UpdateTable(ctx context.Context, table string, schema TableSch
 
 	// Validate duplicates
 	nameSeen := map[string]bool{}
+	var names []string
 	for _, f := range schema.Fields {
 		name := strings.TrimSpace(f.Name)
 		if name == "" {
@@ -404,10 +667,15 @@ func (s *Storage) UpdateTable(ctx context.Context, table string, schema TableSch
 		if nameSeen[name] {
 			return fmt.Errorf("字段名称重复: %s", name)
 		}
+		if err := checkFieldName(name); err != nil {
+			return err
+		}
 		nameSeen[name] = true
+		names = append(names, name)
 	}
 
 	var renamePairs [][2]string
+	var conversions []ConvertRequest
 	var addFields []FieldDefinition
 	keepOld := map[string]bool{}
 	var finalFields []FieldDefinition
@@ -419,35 +687,67 @@ func (s *Storage) UpdateTable(ctx context.Context, table string, schema TableSch
 			oldName = newName
 		}
 		if exist, ok := existingMap[oldName]; ok {
-			if f.TypeHint != "" && !strings.EqualFold(f.TypeHint, exist.TypeHint) {
-				return fmt.Errorf("字段 %s 不支持修改类型", oldName)
-			}
 			if oldName != newName {
 				renamePairs = append(renamePairs, [2]string{oldName, newName})
 			}
-			finalFields = append(finalFields, FieldDefinition{
-				Name:      newName,
-				Labels:    f.Labels,
-				TypeHint:  exist.TypeHint,
-				AllowNull: f.AllowNull,
-			})
+			options := f.Options
+			if options == nil {
+				options = exist.Options
+			}
+			rules := f.Rules
+			if rules == nil {
+				rules = exist.Rules
+			}
+			typeHint := exist.TypeHint
+			if f.TypeHint != "" && !strings.EqualFold(f.TypeHint, exist.TypeHint) {
+				typeHint = f.TypeHint
+				conversions = append(conversions, ConvertRequest{Column: oldName, TypeHint: f.TypeHint, Options: options, Rules: rules})
+			}
+			kept := FieldDefinition{
+				Name:        newName,
+				Labels:      f.Labels,
+				TypeHint:    typeHint,
+				AllowNull:   f.AllowNull,
+				Options:     options,
+				Rules:       rules,
+				Unique:      f.Unique,
+				Indexed:     f.Indexed,
+				Description: f.Description,
+			}
+			if err := validateField(kept, names); err != nil {
+				return err
+			}
+			finalFields = append(finalFields, kept)
 			keepOld[oldName] = true
 		} else {
 			if newName == "" || f.TypeHint == "" {
 				return fmt.Errorf("新增字段 %s 类型不能为空", newName)
 			}
+			if err := validateField(f, names); err != nil {
+				return err
+			}
 			addFields = append(addFields, FieldDefinition{
-				Name:      newName,
-				Labels:    f.Labels,
-				TypeHint:  f.TypeHint,
-				AllowNull: f.AllowNull,
-				Default:   f.Default,
+				Name:        newName,
+				Labels:      f.Labels,
+				TypeHint:    f.TypeHint,
+				AllowNull:   f.AllowNull,
+				Default:     f.Default,
+				Options:     f.Options,
+				Rules:       f.Rules,
+				Unique:      f.Unique,
+				Indexed:     f.Indexed,
+				Description: f.Description,
 			})
 			finalFields = append(finalFields, FieldDefinition{
-				Name:      newName,
-				Labels:    f.Labels,
-				TypeHint:  f.TypeHint,
-				AllowNull: f.AllowNull,
+				Name:        newName,
+				Labels:      f.Labels,
+				TypeHint:    f.TypeHint,
+				AllowNull:   f.AllowNull,
+				Options:     f.Options,
+				Rules:       f.Rules,
+				Unique:      f.Unique,
+				Indexed:     f.Indexed,
+				Description: f.Description,
 			})
 		}
 	}
@@ -463,49 +763,94 @@ func (s *Storage) UpdateTable(ctx context.Context, table string, schema TableSch
 		return errors.New("至少保留一个字段")
 	}
 
-	if targetName != table {
-		if _, err := s.db.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s RENAME TO %s", table, targetName)); err != nil {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Type changes go first, under the old names; any value that does not convert
+	// aborts the whole change.
+	for _, conv := range conversions {
+		if err := s.convertForUpdate(ctx, tx, table, conv); err != nil {
 			return err
 		}
-		if _, err := s.db.ExecContext(ctx, `UPDATE table_meta SET table_name=? WHERE table_name=?`, targetName, table); err != nil {
+	}
+
+	// The index is rebuilt under the final names once the columns are settled.
+	if err := s.dropFTS(ctx, tx, table); err != nil {
+		return err
+	}
+
+	if targetName != table {
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s RENAME TO %s", quoteIdent(table), quoteIdent(targetName))); err != nil {
 			return err
 		}
-		if _, err := s.db.ExecContext(ctx, `UPDATE column_meta SET table_name=? WHERE table_name=?`, targetName, table); err != nil {
-			return err
+		for _, meta := range []string{"table_meta", "column_meta", "table_grants", "row_versions", "schema_versions", "saved_views"} {
+			if _, err := tx.ExecContext(ctx, "UPDATE "+meta+" SET table_name=? WHERE table_name=?", targetName, table); err != nil {
+				return err
+			}
 		}
 		currentTable = targetName
 	}
 
+	renames := map[string]string{}
 	for _, pair := range renamePairs {
-		if _, err := s.db.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s RENAME COLUMN %s TO %s", currentTable, pair[0], pair[1])); err != nil {
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s RENAME COLUMN %s TO %s", quoteIdent(currentTable), quoteIdent(pair[0]), quoteIdent(pair[1]))); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE column_meta SET column_name=? WHERE table_name=? AND column_name=?`, pair[1], currentTable, pair[0]); err != nil {
 			return err
 		}
+		renames[pair[0]] = pair[1]
+	}
+	if err := renameVersionColumns(ctx, tx, currentTable, renames); err != nil {
+		return err
 	}
 
 	if len(dropFields) > 0 {
-		if err := s.DropColumns(ctx, currentTable, dropFields); err != nil {
+		if err := s.dropColumns(ctx, tx, currentTable, dropFields); err != nil {
 			return err
 		}
 	}
 
 	if len(addFields) > 0 {
-		if err := s.AddColumns(ctx, currentTable, addFields); err != nil {
+		if err := s.addColumns(ctx, tx, currentTable, addFields); err != nil {
 			return err
 		}
 	}
 
 	// Sync metadata order/labels and table info.
-	return s.upsertMeta(TableSchema{
+	after := TableSchema{
 		Name:        targetName,
 		DisplayName: schema.DisplayName,
 		Description: schema.Description,
 		Fields:      finalFields,
-	})
+	}
+	if err := s.writeMeta(ctx, tx, after); err != nil {
+		return err
+	}
+	if err := s.applyNullability(ctx, tx, targetName); err != nil {
+		return err
+	}
+	if err := s.rebuildFTS(ctx, tx, targetName); err != nil {
+		return err
+	}
+	if err := s.syncIndexes(ctx, tx, targetName, finalFields); err != nil {
+		return err
+	}
+	if err := s.recordSchema(ctx, tx, AuditUpdateTable, targetName); err != nil {
+		return err
+	}
+	if err := s.audit(ctx, tx, AuditUpdateTable, targetName, 0, before, after); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 func (s *Storage) tableColumns(ctx context.Context, table string) ([]string, error) {
 	s.l.Info("table columns start", zap.String("table", table))
-	rows, err := s.db.QueryContext(ctx, "PRAGMA table_info("+table+")")
+	rows, err := s.db.QueryContext(ctx, "SELECT cid, name, type, \"notnull\", dflt_value, pk FROM pragma_table_info(?)", table)
 	if err != nil {
 		s.l.Error("pragma table_info failed", zap.String("table", table), zap.Error(err))
 		return nil, err
@@ -521,7 +866,7 @@ func (s *Storage) tableColumns(ctx context.Context, table string) ([]string, err
 		if err := rows.Scan(&cid, &name, &ctype, &notnull, &dflt, &pk); err != nil {
 			return nil, err
 		}
-		if name == "id" || name == "created_at" || name == "updated_at" {
+		if isSystemColumn(name) {
 			continue
 		}
 		cols = append(cols, name)
@@ -531,55 +876,113 @@ func (s *Storage) tableColumns(ctx context.Context, table string) ([]string, err
 }
 
 func (s *Storage) InsertRow(ctx context.Context, table string, data map[string]any) (int64, error) {
-	delete(data, "id")
-	delete(data, "created_at")
-	delete(data, "updated_at")
+	for _, col := range systemColumns {
+		delete(data, col)
+	}
 	clean, err := s.prepareData(ctx, table, data, true)
 	if err != nil {
 		return 0, err
 	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	id, err := s.insertRow(ctx, tx, table, clean)
+	if err != nil {
+		return 0, err
+	}
+	return id, tx.Commit()
+}
+
+// insertRow writes a row already validated by prepareDataWithMeta, with its
+// audit entry and first version.
+func (s *Storage) insertRow(ctx context.Context, q execer, table string, clean map[string]any) (int64, error) {
 	keys := make([]string, 0, len(clean))
 	vals := make([]any, 0, len(clean))
 	for k, v := range clean {
 		keys = append(keys, k)
 		vals = append(vals, v)
 	}
-	placeholders := placeholders(len(keys))
-	stmt := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", table, strings.Join(keys, ","), placeholders)
-	res, err := s.db.ExecContext(ctx, stmt, vals...)
+	stmt := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", quoteIdent(table), strings.Join(quoteAll(keys), ","), placeholders(len(keys)))
+	res, err := q.ExecContext(ctx, stmt, vals...)
+	if err != nil {
+		return 0, uniqueError(ctx, q, table, err, clean, 0)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	after, err := fetchRow(ctx, q, table, id)
 	if err != nil {
 		return 0, err
 	}
-	return res.LastInsertId()
+	if err := s.audit(ctx, q, AuditInsert, table, id, nil, after); err != nil {
+		return 0, err
+	}
+	if err := s.recordVersion(ctx, q, AuditInsert, table, id, after); err != nil {
+		return 0, err
+	}
+	return id, nil
 }
 
 func (s *Storage) UpdateRow(ctx context.Context, table string, id int64, data map[string]any) error {
-	delete(data, "id")
-	delete(data, "created_at")
-	delete(data, "updated_at")
+	for _, col := range systemColumns {
+		delete(data, col)
+	}
 	if len(data) == 0 {
 		return nil
 	}
-	clean, err := s.prepareData(ctx, table, data, false)
+	meta, err := s.columnDefs(ctx, table)
+	if err != nil {
+		return err
+	}
+	clean, err := s.prepareDataWithMeta(data, meta, false)
 	if err != nil {
 		return err
 	}
 	var sets []string
 	var vals []any
 	for k, v := range clean {
-		sets = append(sets, fmt.Sprintf("%s=?", k))
+		sets = append(sets, fmt.Sprintf("%s=?", quoteIdent(k)))
 		vals = append(vals, v)
 	}
 	sets = append(sets, "updated_at=CURRENT_TIMESTAMP")
 	vals = append(vals, id)
-	stmt := fmt.Sprintf("UPDATE %s SET %s WHERE id=?", table, strings.Join(sets, ","))
-	_, err = s.db.ExecContext(ctx, stmt, vals...)
-	return err
+	stmt := fmt.Sprintf("UPDATE %s SET %s WHERE id=?", quoteIdent(table), strings.Join(sets, ","))
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	before, err := fetchRow(ctx, tx, table, id)
+	if err != nil {
+		return err
+	}
+	if before["deleted_at"] != nil {
+		return fmt.Errorf("记录 %d 已删除，请先从回收站恢复", id)
+	}
+	if _, err := tx.ExecContext(ctx, stmt, vals...); err != nil {
+		return uniqueError(ctx, tx, table, err, clean, id)
+	}
+	after, err := fetchRow(ctx, tx, table, id)
+	if err != nil {
+		return err
+	}
+	if err := checkRequiredIf(meta, after); err != nil {
+		return err
+	}
+	if err := s.audit(ctx, tx, AuditUpdate, table, id, before, after); err != nil {
+		return err
+	}
+	if err := s.recordVersion(ctx, tx, AuditUpdate, table, id, after); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 func (s *Storage) DeleteRow(ctx context.Context, table string, id int64) error {
-	_, err := s.db.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE id=?", table), id)
-	return err
+	return s.DeleteRows(ctx, table, []int64{id})
 }
 
 func (s *Storage) DeleteRows(ctx context.Context, table string, ids []int64) error {
@@ -596,45 +999,165 @@ func (s *Storage) DeleteRows(ctx context.Context, table string, ids []int64) err
 		args[i] = id
 	}
 
-	query := fmt.Sprintf("DELETE FROM %s WHERE id IN (%s)", table, ph)
+	query := fmt.Sprintf("UPDATE %s SET deleted_at=CURRENT_TIMESTAMP WHERE deleted_at IS NULL AND id IN (%s)", quoteIdent(table), ph)
 
 	s.l.Info("batch delete rows", zap.String("table", table), zap.Int("count", len(ids)))
 
-	_, err := s.db.ExecContext(ctx, query, args...)
-	return err
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	rows, err := selectRows(ctx, tx, fmt.Sprintf("SELECT * FROM %s WHERE deleted_at IS NULL AND id IN (%s)", quoteIdent(table), ph), args...)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		return err
+	}
+	if err := s.auditRows(ctx, tx, AuditDelete, table, rows); err != nil {
+		return err
+	}
+	if err := s.recordVersions(ctx, tx, AuditDelete, table, rows); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// fetchRow returns the full row including timestamps, for audit snapshots.
+func fetchRow(ctx context.Context, q execer, table string, id int64) (map[string]any, error) {
+	rows, err := selectRows(ctx, q, fmt.Sprintf("SELECT * FROM %s WHERE id=?", quoteIdent(table)), id)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("记录 %d 不存在", id)
+	}
+	return rows[0], nil
+}
+
+func selectRows(ctx context.Context, q execer, query string, args ...any) ([]map[string]any, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	cols, _ := rows.Columns()
+	var result []map[string]any
+	for rows.Next() {
+		values := make([]any, len(cols))
+		valuePtrs := make([]any, len(cols))
+		for i := range cols {
+			valuePtrs[i] = &values[i]
+		}
+		if err := rows.Scan(valuePtrs...); err != nil {
+			return nil, err
+		}
+		row := map[string]any{}
+		for i, col := range cols {
+			if b, ok := values[i].([]byte); ok {
+				values[i] = string(b)
+			}
+			row[col] = values[i]
+		}
+		result = append(result, row)
+	}
+	return result, rows.Err()
 }
 
-func (s *Storage) Query(ctx context.Context, table string, opts QueryOptions) ([]map[string]any, int, error) {
+// Query returns one page of rows. Columns limits the fields read (id is always
+// included); a Cursor from the previous page switches from OFFSET to keyset paging.
+func (s *Storage) Query(ctx context.Context, table string, opts QueryOptions) (*QueryResult, error) {
 	if opts.Page < 1 {
 		opts.Page = 1
 	}
 	if opts.PageSize <= 0 {
 		opts.PageSize = 20
 	}
+	if err := s.CheckTable(ctx, table); err != nil {
+		return nil, err
+	}
 	columns, err := s.tableColumns(ctx, table)
 	if err != nil {
-		return nil, 0, err
+		return nil, err
 	}
-	where, params := buildFilters(opts, columns)
-	totalSQL := fmt.Sprintf("SELECT COUNT(1) FROM %s %s", table, where)
-	var total int
-	if err := s.db.QueryRowContext(ctx, totalSQL, params...).Scan(&total); err != nil {
-		return nil, 0, err
+	defs, err := s.columnDefs(ctx, table)
+	if err != nil {
+		return nil, err
+	}
+	selected := columns
+	if len(opts.Columns) > 0 {
+		selected = make([]string, 0, len(opts.Columns))
+		for _, col := range opts.Columns {
+			if col == "id" || slices.Contains(selected, col) {
+				continue
+			}
+			if !slices.Contains(columns, col) {
+				return nil, filterErr("字段 %s 不存在", col)
+			}
+			selected = append(selected, col)
+		}
 	}
 
-	offset := (opts.Page - 1) * opts.PageSize
-	order := "ORDER BY id DESC"
+	idCol := qualify(table, "id")
+	key, desc := idCol, true
+	with, join := "", ""
+	plan := s.planSearch(ctx, table, opts.Search)
+	if plan != nil {
+		opts.Search = ""
+		with, join = plan.with, plan.join
+		key, desc = plan.rank, false
+	}
 	if opts.SortBy != "" && slices.Contains(columns, opts.SortBy) {
-		order = fmt.Sprintf("ORDER BY %s %s", opts.SortBy, ternary(opts.Desc, "DESC", "ASC"))
+		key, desc = qualify(table, opts.SortBy), opts.Desc
+	}
+	where, params, err := buildFilters(opts, columns, defs)
+	if err != nil {
+		return nil, err
+	}
+	if plan != nil {
+		where, params = plan.apply(where, params)
+	}
+
+	result := &QueryResult{Items: []map[string]any{}}
+	if !opts.SkipTotal {
+		totalSQL := fmt.Sprintf("%sSELECT COUNT(1) FROM %s%s %s", with, quoteIdent(table), join, where)
+		if err := s.db.QueryRowContext(ctx, totalSQL, params...).Scan(&result.Total); err != nil {
+			return nil, err
+		}
 	}
-	querySQL := fmt.Sprintf("SELECT * FROM %s %s %s LIMIT %d OFFSET %d", table, where, order, opts.PageSize, offset)
+
+	offset := (opts.Page - 1) * opts.PageSize
+	if opts.Cursor != "" {
+		cur, err := decodeCursor(opts.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		clause, args := keysetClause(key, idCol, desc, cur)
+		where += " AND " + clause
+		params = append(params, args...)
+		offset = 0
+	}
+	dir := ternary(desc, "DESC", "ASC")
+	order := fmt.Sprintf("ORDER BY %s %s", key, dir)
+	fieldList := make([]string, 0, len(selected)+2)
+	fieldList = append(fieldList, idCol)
+	for _, col := range selected {
+		fieldList = append(fieldList, qualify(table, col))
+	}
+	if key != idCol {
+		order += fmt.Sprintf(", %s %s", idCol, dir)
+		fieldList = append(fieldList, key+" AS "+cursorKeyColumn)
+	}
+	querySQL := fmt.Sprintf("%sSELECT %s FROM %s%s %s %s LIMIT %d OFFSET %d",
+		with, strings.Join(fieldList, ", "), quoteIdent(table), join, where, order, opts.PageSize, offset)
 	rows, err := s.db.QueryContext(ctx, querySQL, params...)
 	if err != nil {
-		return nil, 0, err
+		return nil, err
 	}
 	defer rows.Close()
 	cols, _ := rows.Columns()
-	var result []map[string]any
+	var lastKey any
 	for rows.Next() {
 		values := make([]any, len(cols))
 		valuePtrs := make([]any, len(cols))
@@ -642,38 +1165,69 @@ func (s *Storage) Query(ctx context.Context, table string, opts QueryOptions) ([
 			valuePtrs[i] = &values[i]
 		}
 		if err := rows.Scan(valuePtrs...); err != nil {
-			return nil, 0, err
+			return nil, err
 		}
 		row := map[string]any{}
 		for i, col := range cols {
-			if col == "created_at" || col == "updated_at" {
+			if col == cursorKeyColumn {
+				lastKey = values[i]
 				continue
 			}
 			row[col] = values[i]
 		}
-		result = append(result, row)
+		result.Items = append(result.Items, row)
 	}
-	return result, total, nil
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(result.Items) == opts.PageSize {
+		last := result.Items[len(result.Items)-1]
+		id, _ := last["id"].(int64)
+		result.NextCursor = encodeCursor(lastKey, id)
+	}
+	return result, nil
 }
 
+// fetchRowsForExport reads the given fields; filters and sorting may still refer to
+// any column of the table.
 func (s *Storage) fetchRowsForExport(ctx context.Context, table string, fields []FieldDefinition, opts QueryOptions, ids []int64, all bool) ([]map[string]any, error) {
 	columns := make([]string, 0, len(fields))
 	for _, f := range fields {
 		columns = append(columns, f.Name)
 	}
+	tableCols, err := s.tableColumns(ctx, table)
+	if err != nil {
+		return nil, err
+	}
+	defs, err := s.columnDefs(ctx, table)
+	if err != nil {
+		return nil, err
+	}
 
+	order := "ORDER BY id DESC"
+	with, join := "", ""
 	var where string
 	var params []any
 	if len(ids) > 0 {
-		where = fmt.Sprintf("WHERE id IN (%s)", placeholders(len(ids)))
+		where = fmt.Sprintf("WHERE deleted_at IS NULL AND id IN (%s)", placeholders(len(ids)))
 		params = toAny64(ids)
 	} else {
-		where, params = buildFilters(opts, columns)
+		plan := s.planSearch(ctx, table, opts.Search)
+		if plan != nil {
+			opts.Search = ""
+			with, join, order = plan.with, plan.join, plan.order
+		}
+		where, params, err = buildFilters(opts, tableCols, defs)
+		if err != nil {
+			return nil, err
+		}
+		if plan != nil {
+			where, params = plan.apply(where, params)
+		}
 	}
 
-	order := "ORDER BY id DESC"
-	if opts.SortBy != "" && slices.Contains(columns, opts.SortBy) {
-		order = fmt.Sprintf("ORDER BY %s %s", opts.SortBy, ternary(opts.Desc, "DESC", "ASC"))
+	if opts.SortBy != "" && slices.Contains(tableCols, opts.SortBy) {
+		order = fmt.Sprintf("ORDER BY %s %s", quoteIdent(opts.SortBy), ternary(opts.Desc, "DESC", "ASC"))
 	}
 
 	sqlWhere := ""
@@ -693,7 +1247,7 @@ func (s *Storage) fetchRowsForExport(ctx context.Context, table string, fields [
 		limit = fmt.Sprintf(" LIMIT %d OFFSET %d", opts.PageSize, offset)
 	}
 
-	querySQL := fmt.Sprintf("SELECT %s FROM %s%s %s%s", strings.Join(columns, ","), table, sqlWhere, order, limit)
+	querySQL := fmt.Sprintf("%sSELECT %s FROM %s%s%s %s%s", with, strings.Join(quoteAll(columns), ","), quoteIdent(table), join, sqlWhere, order, limit)
 	rows, err := s.db.QueryContext(ctx, querySQL, params...)
 	if err != nil {
 		return nil, err
@@ -724,6 +1278,12 @@ func (s *Storage) ExportExcel(ctx context.Context, table string, opts QueryOptio
 	if err != nil {
 		return nil, "", err
 	}
+	if len(opts.Columns) > 0 {
+		fields = orderFields(fields, opts.Columns)
+		if len(fields) == 0 {
+			return nil, "", filterErr("没有可导出的字段")
+		}
+	}
 	rows, err := s.fetchRowsForExport(ctx, table, fields, opts, ids, all)
 	if err != nil {
 		return nil, "", err
@@ -753,13 +1313,30 @@ func (s *Storage) ExportExcel(ctx context.Context, table string, opts QueryOptio
 	return buf.Bytes(), s.tableDisplayName(ctx, table), nil
 }
 
-func buildFilters(opts QueryOptions, columns []string) (string, []any) {
-	var clauses []string
+// orderFields keeps only the named fields, in the given order.
+func orderFields(fields []FieldDefinition, names []string) []FieldDefinition {
+	byName := make(map[string]FieldDefinition, len(fields))
+	for _, f := range fields {
+		byName[f.Name] = f
+	}
+	out := make([]FieldDefinition, 0, len(names))
+	for _, n := range names {
+		if f, ok := byName[n]; ok {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+// buildFilters combines the free-text search, the legacy LIKE filters and the
+// structured Where tree into one WHERE clause.
+func buildFilters(opts QueryOptions, columns []string, defs map[string]FieldDefinition) (string, []any, error) {
+	clauses := []string{"deleted_at IS NULL"}
 	var params []any
 	if opts.Search != "" {
 		var parts []string
 		for _, col := range columns {
-			parts = append(parts, fmt.Sprintf("%s LIKE ?", col))
+			parts = append(parts, fmt.Sprintf("%s LIKE ?", quoteIdent(col)))
 			params = append(params, "%"+opts.Search+"%")
 		}
 		if len(parts) > 0 {
@@ -770,13 +1347,18 @@ func buildFilters(opts QueryOptions, columns []string) (string, []any) {
 		if !slices.Contains(columns, k) {
 			continue
 		}
-		clauses = append(clauses, fmt.Sprintf("%s LIKE ?", k))
+		clauses = append(clauses, fmt.Sprintf("%s LIKE ?", quoteIdent(k)))
 		params = append(params, "%"+v+"%")
 	}
-	if len(clauses) == 0 {
-		return "", nil
+	if opts.Where != nil {
+		clause, args, err := compileFilter(opts.Where, columns, defs)
+		if err != nil {
+			return "", nil, err
+		}
+		clauses = append(clauses, clause)
+		params = append(params, args...)
 	}
-	return "WHERE " + strings.Join(clauses, " AND "), params
+	return "WHERE " + strings.Join(clauses, " AND "), params, nil
 }
 
 func (s *Storage) buildImportContext(ctx context.Context, table string, header []string, aliases map[string]string, allowUnknown bool) ([]string, map[string]FieldDefinition, error) {
@@ -827,7 +1409,7 @@ func (s *Storage) buildImportContext(ctx context.Context, table string, header [
 	return mapping, metaMap, nil
 }
 
-func (s *Storage) importRecord(ctx context.Context, table string, mapping []string, metaMap map[string]FieldDefinition, record []string) error {
+func (s *Storage) importRecord(ctx context.Context, q execer, table string, mapping []string, metaMap map[string]FieldDefinition, record []string) error {
 	row := map[string]any{}
 	for i, col := range mapping {
 		if i >= len(record) {
@@ -842,7 +1424,7 @@ func (s *Storage) importRecord(ctx context.Context, table string, mapping []stri
 	if err != nil {
 		return err
 	}
-	_, err = s.InsertRow(ctx, table, clean)
+	_, err = s.insertRow(ctx, q, table, clean)
 	return err
 }
 
@@ -859,25 +1441,35 @@ func (s *Storage) ImportCSV(ctx context.Context, table string, r io.Reader, allo
 		return 0, err
 	}
 
+	// The whole file is imported in one transaction: a bad row leaves the table
+	// unchanged.
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
 	inserted := 0
-	for {
+	for line := 2; ; line++ {
 		record, err := reader.Read()
 		if errors.Is(err, io.EOF) {
 			break
 		}
 		if err != nil {
-			return inserted, err
+			return 0, err
 		}
 		if len(record) == 0 || isEmptyRow(record) {
 			continue
 		}
 
-		if err := s.importRecord(ctx, table, mapping, metaMap, record); err != nil {
-			return inserted, err
+		if err := s.importRecord(ctx, tx, table, mapping, metaMap, record); err != nil {
+			return 0, fmt.Errorf("第 %d 行: %w", line, err)
 		}
 		inserted++
 	}
-	return inserted, nil
+	if err := s.audit(ctx, tx, AuditImport, table, 0, nil, map[string]any{"format": "csv", "imported": inserted}); err != nil {
+		return 0, err
+	}
+	return inserted, tx.Commit()
 }
 
 func (s *Storage) ImportExcel(ctx context.Context, table string, data []byte, allowUnknown bool, aliases map[string]string) (int, error) {
@@ -920,21 +1512,66 @@ func (s *Storage) ImportExcel(ctx context.Context, table string, data []byte, al
 		return 0, err
 	}
 
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
 	inserted := 0
-	for rows.Next() {
+	for line := 2; rows.Next(); line++ {
 		record, err := rows.Columns()
 		if err != nil {
-			return inserted, err
+			return 0, err
 		}
 		if len(record) == 0 || isEmptyRow(record) {
 			continue
 		}
-		if err := s.importRecord(ctx, table, mapping, metaMap, record); err != nil {
-			return inserted, err
+		if err := excelDates(file, sheet, line, mapping, metaMap, record); err != nil {
+			return 0, err
+		}
+		if err := s.importRecord(ctx, tx, table, mapping, metaMap, record); err != nil {
+			return 0, fmt.Errorf("第 %d 行: %w", line, err)
 		}
 		inserted++
 	}
-	return inserted, nil
+	if err := s.audit(ctx, tx, AuditImport, table, 0, nil, map[string]any{"format": "xlsx", "imported": inserted}); err != nil {
+		return 0, err
+	}
+	return inserted, tx.Commit()
+}
+
+// excelDates replaces numeric cells of date columns with their ISO date. Excel
+// stores dates as serial numbers and excelize renders them in the cell's display
+// format, which is often an ambiguous mm-dd-yy.
+func excelDates(file *excelize.File, sheet string, line int, mapping []string, metaMap map[string]FieldDefinition, record []string) error {
+	for i, col := range mapping {
+		if i >= len(record) || col == "" || strings.TrimSpace(record[i]) == "" {
+			continue
+		}
+		def, ok := metaMap[col]
+		if !ok || !isDateHint(def.TypeHint) {
+			continue
+		}
+		cell, err := excelize.CoordinatesToCellName(i+1, line)
+		if err != nil {
+			return err
+		}
+		typ, err := file.GetCellType(sheet, cell)
+		if err != nil {
+			return err
+		}
+		if typ != excelize.CellTypeNumber && typ != excelize.CellTypeUnset {
+			continue
+		}
+		raw, err := file.GetCellValue(sheet, cell, excelize.Options{RawCellValue: true})
+		if err != nil {
+			return err
+		}
+		if t, ok := excelSerialDate(raw); ok {
+			record[i] = formatDate(def.TypeHint, t)
+		}
+	}
+	return nil
 }
 
 func isEmptyRow(cells []string) bool {
@@ -1005,22 +1642,35 @@ func (s *Storage) prepareDataWithMeta(data map[string]any, meta map[string]Field
 		val, ok := data[name]
 		if !ok {
 			if isInsert && !def.AllowNull {
-				return nil, fmt.Errorf("字段 %s 为必填", name)
+				return nil, inputErr("字段 %s 为必填", name)
 			}
 			continue
 		}
-		converted, err := convertValue(def.TypeHint, val)
+		converted, err := convertField(def, val)
 		if err != nil {
-			return nil, fmt.Errorf("字段 %s: %w", name, err)
+			return nil, inputErr("字段 %s: %v", name, err)
 		}
 		if converted == nil {
 			if !def.AllowNull {
-				return nil, fmt.Errorf("字段 %s 为必填", name)
+				return nil, inputErr("字段 %s 为必填", name)
+			}
+			// An explicit empty value on update clears the field.
+			if !isInsert {
+				result[name] = nil
 			}
 			continue
 		}
+		if err := def.checkValue(converted); err != nil {
+			return nil, inputErr("字段 %s %v", name, err)
+		}
 		result[name] = converted
 	}
+	// Updates are checked against the merged row in UpdateRow.
+	if isInsert {
+		if err := checkRequiredIf(meta, result); err != nil {
+			return nil, err
+		}
+	}
 	return result, nil
 }
 
@@ -1032,6 +1682,9 @@ func convertValue(typeHint string, val any) (any, error) {
 	case "integer", "int", "计数", "布尔":
 		switch v := val.(type) {
 		case float64:
+			if v != math.Trunc(v) || math.Abs(v) >= 1<<63 {
+				return nil, fmt.Errorf("需要整数")
+			}
 			return int64(v), nil
 		case int, int32, int64:
 			return v, nil
@@ -1085,13 +1738,7 @@ func convertValue(typeHint string, val any) (any, error) {
 			return nil, fmt.Errorf("需要是/否")
 		}
 	case "date", "datetime", "日期", "时间":
-		if s, ok := val.(string); ok {
-			if strings.TrimSpace(s) == "" {
-				return nil, nil
-			}
-			return s, nil
-		}
-		return fmt.Sprint(val), nil
+		return normalizeDate(typeHint, val)
 	default: // text
 		if s, ok := val.(string); ok {
 			if strings.TrimSpace(s) == "" {
@@ -1103,72 +1750,6 @@ func convertValue(typeHint string, val any) (any, error) {
 	}
 }
 
-// Basic analytics to support spreadsheet-like summaries.
-func (s *Storage) Summary(ctx context.Context, table string, column string) (map[string]float64, error) {
-	// ensure type is numeric
-	cols, err := s.listColumns(ctx, table)
-	if err != nil {
-		return nil, err
-	}
-	var typeHint string
-	for _, c := range cols {
-		if c.Name == column {
-			typeHint = strings.ToLower(c.TypeHint)
-			break
-		}
-	}
-	if typeHint == "" {
-		return nil, fmt.Errorf("字段不存在")
-	}
-	if !(strings.Contains(typeHint, "int") || strings.Contains(typeHint, "数值") || strings.Contains(typeHint, "number") || strings.Contains(typeHint, "float")) {
-		return nil, fmt.Errorf("字段 %s 不是数值类型，无法统计", column)
-	}
-
-	rows, err := s.db.QueryContext(ctx, fmt.Sprintf("SELECT %s FROM %s", column, table))
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-	var nums []float64
-	for rows.Next() {
-		var v sql.NullFloat64
-		if err := rows.Scan(&v); err != nil {
-			return nil, err
-		}
-		if v.Valid {
-			nums = append(nums, v.Float64)
-		}
-	}
-	if len(nums) == 0 {
-		return map[string]float64{"count": 0}, nil
-	}
-	sum := 0.0
-	min, max := nums[0], nums[0]
-	for _, n := range nums {
-		sum += n
-		if n < min {
-			min = n
-		}
-		if n > max {
-			max = n
-		}
-	}
-	avg := sum / float64(len(nums))
-	var variance float64
-	for _, n := range nums {
-		variance += math.Pow(n-avg, 2)
-	}
-	variance /= float64(len(nums))
-	return map[string]float64{
-		"count":   float64(len(nums)),
-		"sum":     sum,
-		"average": avg,
-		"max":     max,
-		"min":     min,
-		"std":     math.Sqrt(variance),
-	}, nil
-}
-
 func mapType(hint string) string {
 	switch strings.ToLower(hint) {
 	case "text", "string", "长文本", "短文本":
@@ -1181,11 +1762,20 @@ func mapType(hint string) string {
 		return "INTEGER"
 	case "date", "datetime", "日期", "时间":
 		return "TEXT"
+	case "enum", "单选", "multi", "多选":
+		return "TEXT"
 	default:
 		return ""
 	}
 }
 
+// systemColumns are maintained by storage itself and never accepted from clients.
+var systemColumns = []string{"id", "created_at", "updated_at", "deleted_at"}
+
+func isSystemColumn(name string) bool {
+	return slices.Contains(systemColumns, name)
+}
+
 func excelColumnName(idx int) string {
 	idx += 1
 	var name []rune
@@ -0,0 +1,258 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// maxCategories bounds GROUP BY summaries and frequency tables so grouping by a
+// free-text column does not return one group per row.
+const maxCategories = 200
+
+// SummaryGroup holds the statistics of one value of the group_by column.
+type SummaryGroup struct {
+	Value   any                `json:"value"`
+	Summary map[string]float64 `json:"summary"`
+}
+
+type SummaryResult struct {
+	Summary map[string]float64 `json:"summary"`
+	GroupBy string             `json:"group_by,omitempty"`
+	Groups  []SummaryGroup     `json:"groups,omitempty"`
+}
+
+// rowScope is the FROM/WHERE part shared by the statistics: soft-deleted rows are
+// excluded and the caller's search and filters apply exactly as in Query.
+type rowScope struct {
+	with   string
+	from   string
+	where  string
+	params []any
+}
+
+func (s *Storage) scopeRows(ctx context.Context, table string, opts QueryOptions) (*rowScope, error) {
+	if err := s.CheckTable(ctx, table); err != nil {
+		return nil, err
+	}
+	columns, err := s.tableColumns(ctx, table)
+	if err != nil {
+		return nil, err
+	}
+	defs, err := s.columnDefs(ctx, table)
+	if err != nil {
+		return nil, err
+	}
+	sc := &rowScope{from: quoteIdent(table)}
+	plan := s.planSearch(ctx, table, opts.Search)
+	if plan != nil {
+		opts.Search = ""
+		sc.with = plan.with
+		sc.from += plan.join
+	}
+	where, params, err := buildFilters(opts, columns, defs)
+	if err != nil {
+		return nil, err
+	}
+	if plan != nil {
+		where, params = plan.apply(where, params)
+	}
+	sc.where, sc.params = where, params
+	return sc, nil
+}
+
+func (sc *rowScope) query(selectList, suffix string) string {
+	return fmt.Sprintf("%sSELECT %s FROM %s %s %s", sc.with, selectList, sc.from, sc.where, suffix)
+}
+
+func isNumericHint(typeHint string) bool {
+	typeHint = strings.ToLower(typeHint)
+	return strings.Contains(typeHint, "int") || strings.Contains(typeHint, "数值") || strings.Contains(typeHint, "number") || strings.Contains(typeHint, "float")
+}
+
+// SummaryRequest names the column to describe. Percentiles are extra cut points in
+// (0, 100) reported as p<N> next to the quartiles.
+type SummaryRequest struct {
+	Column      string
+	GroupBy     string
+	Percentiles []float64
+}
+
+// sample collects one column's values. Empty cells count as missing; text that is
+// not a number (e.g. "<5" typed into a numeric field) is counted separately.
+type sample struct {
+	nums       []float64
+	missing    int
+	nonNumeric int
+}
+
+func (sm *sample) add(v any) {
+	switch x := v.(type) {
+	case nil:
+		sm.missing++
+	case int64:
+		sm.nums = append(sm.nums, float64(x))
+	case float64:
+		sm.nums = append(sm.nums, x)
+	case []byte:
+		sm.add(string(x))
+	case string:
+		text := strings.TrimSpace(x)
+		if text == "" {
+			sm.missing++
+			return
+		}
+		f, err := strconv.ParseFloat(text, 64)
+		if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+			sm.nonNumeric++
+			return
+		}
+		sm.nums = append(sm.nums, f)
+	default:
+		sm.nonNumeric++
+	}
+}
+
+// Summary describes a numeric column over the rows matching opts. With GroupBy set
+// the same statistics are also returned for every value of that column.
+func (s *Storage) Summary(ctx context.Context, table string, req SummaryRequest, opts QueryOptions) (*SummaryResult, error) {
+	column, groupBy := req.Column, req.GroupBy
+	defs, err := s.columnDefs(ctx, table)
+	if err != nil {
+		return nil, err
+	}
+	def, ok := defs[column]
+	if !ok {
+		return nil, fmt.Errorf("字段不存在")
+	}
+	if !isNumericHint(def.TypeHint) {
+		return nil, fmt.Errorf("字段 %s 不是数值类型，无法统计", column)
+	}
+	if groupBy != "" {
+		if _, ok := defs[groupBy]; !ok {
+			return nil, filterErr("分组字段 %s 不存在", groupBy)
+		}
+	}
+	for _, p := range req.Percentiles {
+		if p <= 0 || p >= 100 {
+			return nil, filterErr("百分位数需在 0 到 100 之间: %v", p)
+		}
+	}
+	sc, err := s.scopeRows(ctx, table, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	query := sc.query(qualify(table, column), "")
+	if groupBy != "" {
+		query = sc.query(qualify(table, column)+", "+qualify(table, groupBy), "ORDER BY "+qualify(table, groupBy))
+	}
+	rows, err := s.db.QueryContext(ctx, query, sc.params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var all sample
+	var groups []SummaryGroup
+	var groupSamples []*sample
+	for rows.Next() {
+		var v, g any
+		dest := []any{&v}
+		if groupBy != "" {
+			dest = append(dest, &g)
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		all.add(v)
+		if groupBy == "" {
+			continue
+		}
+		if b, ok := g.([]byte); ok {
+			g = string(b)
+		}
+		if len(groups) == 0 || groups[len(groups)-1].Value != g {
+			if len(groups) == maxCategories {
+				return nil, filterErr("分组字段 %s 的取值超过 %d 个", groupBy, maxCategories)
+			}
+			groups = append(groups, SummaryGroup{Value: g})
+			groupSamples = append(groupSamples, &sample{})
+		}
+		groupSamples[len(groupSamples)-1].add(v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	res := &SummaryResult{Summary: describe(&all, req.Percentiles)}
+	if groupBy != "" {
+		res.GroupBy = groupBy
+		res.Groups = groups
+		for i := range res.Groups {
+			res.Groups[i].Summary = describe(groupSamples[i], req.Percentiles)
+		}
+		if res.Groups == nil {
+			res.Groups = []SummaryGroup{}
+		}
+	}
+	return res, nil
+}
+
+// describe returns count, missing and non_numeric always, and the location and
+// spread statistics once there is data. std is the population SD kept for existing
+// clients; sd is the sample SD used for the 95% CI of the mean (t distribution).
+// Quantiles interpolate linearly between order statistics (R type 7, Excel
+// PERCENTILE.INC).
+func describe(sm *sample, percentiles []float64) map[string]float64 {
+	n := len(sm.nums)
+	out := map[string]float64{
+		"count":       float64(n),
+		"missing":     float64(sm.missing),
+		"non_numeric": float64(sm.nonNumeric),
+	}
+	if n == 0 {
+		return out
+	}
+	sorted := slices.Clone(sm.nums)
+	slices.Sort(sorted)
+	sum := 0.0
+	for _, x := range sorted {
+		sum += x
+	}
+	avg := sum / float64(n)
+	var ss float64
+	for _, x := range sorted {
+		ss += (x - avg) * (x - avg)
+	}
+	out["sum"] = sum
+	out["average"] = avg
+	out["min"] = sorted[0]
+	out["max"] = sorted[n-1]
+	out["std"] = math.Sqrt(ss / float64(n))
+	out["median"] = quantile(sorted, 0.5)
+	out["q1"] = quantile(sorted, 0.25)
+	out["q3"] = quantile(sorted, 0.75)
+	out["iqr"] = out["q3"] - out["q1"]
+	for _, p := range percentiles {
+		out["p"+strconv.FormatFloat(p, 'f', -1, 64)] = quantile(sorted, p/100)
+	}
+	if n >= 2 {
+		sd := math.Sqrt(ss / float64(n-1))
+		half := studentTQuantile(0.975, float64(n-1)) * sd / math.Sqrt(float64(n))
+		out["sd"] = sd
+		out["ci95_low"] = avg - half
+		out["ci95_high"] = avg + half
+	}
+	return out
+}
+
+func quantile(sorted []float64, p float64) float64 {
+	pos := p * float64(len(sorted)-1)
+	lo := int(math.Floor(pos))
+	if lo+1 >= len(sorted) {
+		return sorted[len(sorted)-1]
+	}
+	return sorted[lo] + (pos-float64(lo))*(sorted[lo+1]-sorted[lo])
+}
@@ -0,0 +1,73 @@
+package storage
+
+import "testing"
+
+func TestQuantile(t *testing.T) {
+	oneToTen := []float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	// Reference values from R's quantile(type = 7), the default.
+	cases := []struct {
+		name   string
+		sorted []float64
+		p      float64
+		want   float64
+	}{
+		{"q1", oneToTen, 0.25, 3.25},
+		{"median even", oneToTen, 0.5, 5.5},
+		{"q3", oneToTen, 0.75, 7.75},
+		{"p90", oneToTen, 0.9, 9.1},
+		{"min", oneToTen, 0, 1},
+		{"max", oneToTen, 1, 10},
+		{"median odd", []float64{1, 3, 7}, 0.5, 3},
+		{"single", []float64{42}, 0.3, 42},
+	}
+	for _, c := range cases {
+		near(t, c.name, quantile(c.sorted, c.p), c.want, 1e-12)
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	sm := &sample{}
+	for _, v := range []any{int64(2), 4.0, "4", []byte("4"), int64(5), " 5 ", 7.0, int64(9), nil, "", "<5", "NaN"} {
+		sm.add(v)
+	}
+	got := describe(sm, []float64{10, 90})
+	want := map[string]float64{
+		"count":       8,
+		"missing":     2,
+		"non_numeric": 2,
+		"sum":         40,
+		"average":     5,
+		"min":         2,
+		"max":         9,
+		"std":         2,
+		"sd":          2.138089935299395,
+		"median":      4.5,
+		"q1":          4,
+		"q3":          5.5,
+		"iqr":         1.5,
+		"p10":         3.4,
+		"p90":         7.6,
+		"ci95_low":    5 - 1.7874879182362104,
+		"ci95_high":   5 + 1.7874879182362104,
+	}
+	for key, w := range want {
+		v, ok := got[key]
+		if !ok {
+			t.Errorf("%s missing", key)
+			continue
+		}
+		near(t, key, v, w, 1e-6)
+	}
+}
+
+func TestDescribeSmallSamples(t *testing.T) {
+	empty := describe(&sample{missing: 3}, nil)
+	if len(empty) != 3 || empty["missing"] != 3 || empty["count"] != 0 {
+		t.Errorf("empty sample = %v", empty)
+	}
+	one := describe(&sample{nums: []float64{7}}, nil)
+	if _, ok := one["sd"]; ok {
+		t.Errorf("sd reported for one value: %v", one)
+	}
+	near(t, "median", one["median"], 7, 0)
+}
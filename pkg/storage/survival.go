@@ -0,0 +1,326 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// SurvivalRequest describes a time-to-event analysis: follow-up runs from Start to
+// End (the event date, or the last visit for censored rows) and Event says whether
+// the event happened at End.
+type SurvivalRequest struct {
+	Start   string
+	End     string
+	Event   string
+	GroupBy string
+	Groups  []string
+}
+
+// SurvivalPoint is one step of a Kaplan-Meier curve. The 95% CI uses Greenwood's
+// variance on the log scale, as R's survfit does by default.
+type SurvivalPoint struct {
+	Time     float64 `json:"time"`
+	AtRisk   int     `json:"at_risk"`
+	Events   int     `json:"events"`
+	Censored int     `json:"censored"`
+	Survival float64 `json:"survival"`
+	CILow    float64 `json:"ci_low"`
+	CIHigh   float64 `json:"ci_high"`
+}
+
+type SurvivalCurve struct {
+	Value    any             `json:"value,omitempty"`
+	N        int             `json:"n"`
+	Events   int             `json:"events"`
+	Censored int             `json:"censored"`
+	Median   *float64        `json:"median"`
+	Points   []SurvivalPoint `json:"points"`
+}
+
+type LogRankResult struct {
+	Statistic float64 `json:"statistic"`
+	DF        float64 `json:"df"`
+	PValue    float64 `json:"p_value"`
+}
+
+// SurvivalResult times are in days. Excluded counts rows without usable dates or
+// event flag, or with an end before the start. Notes explain a missing LogRank.
+type SurvivalResult struct {
+	Unit     string          `json:"unit"`
+	Curves   []SurvivalCurve `json:"curves"`
+	LogRank  *LogRankResult  `json:"log_rank,omitempty"`
+	Excluded int             `json:"excluded"`
+	Notes    []string        `json:"notes,omitempty"`
+}
+
+type survivalObs struct {
+	time  float64
+	event bool
+}
+
+func (s *Storage) Survival(ctx context.Context, table string, req SurvivalRequest, opts QueryOptions) (*SurvivalResult, error) {
+	columns, err := s.tableColumns(ctx, table)
+	if err != nil {
+		return nil, err
+	}
+	for _, col := range []string{req.Start, req.End, req.Event} {
+		if col == "" {
+			return nil, filterErr("需要指定开始日期、结束日期和事件字段")
+		}
+		if !slices.Contains(columns, col) {
+			return nil, filterErr("字段 %s 不存在", col)
+		}
+	}
+	groupExpr := "NULL"
+	if req.GroupBy != "" {
+		if !slices.Contains(columns, req.GroupBy) {
+			return nil, filterErr("分组字段 %s 不存在", req.GroupBy)
+		}
+		groupExpr = categoryExpr(table, req.GroupBy)
+	}
+	sc, err := s.scopeRows(ctx, table, opts)
+	if err != nil {
+		return nil, err
+	}
+	query := sc.query(strings.Join([]string{qualify(table, req.Start), qualify(table, req.End), qualify(table, req.Event), groupExpr}, ", "), "")
+	rows, err := s.db.QueryContext(ctx, query, sc.params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	res := &SurvivalResult{Unit: "days", Curves: []SurvivalCurve{}}
+	byGroup := map[any][]survivalObs{}
+	var values []any
+	for rows.Next() {
+		var start, end, flag, g any
+		if err := rows.Scan(&start, &end, &flag, &g); err != nil {
+			return nil, err
+		}
+		g = categoryValue(g)
+		if req.GroupBy != "" && (g == nil || len(req.Groups) > 0 && !slices.Contains(req.Groups, fmt.Sprint(g))) {
+			continue
+		}
+		t0, ok1 := parseDate(start)
+		t1, ok2 := parseDate(end)
+		event, ok3 := eventFlag(flag)
+		if !ok1 || !ok2 || !ok3 || t1.Before(t0) {
+			res.Excluded++
+			continue
+		}
+		if _, ok := byGroup[g]; !ok {
+			if len(byGroup) == maxCategories {
+				return nil, filterErr("分组字段 %s 的取值超过 %d 个", req.GroupBy, maxCategories)
+			}
+			values = append(values, g)
+		}
+		byGroup[g] = append(byGroup[g], survivalObs{time: t1.Sub(t0).Hours() / 24, event: event})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	sortCategories(values)
+	res.addCurves(values, byGroup)
+	return res, nil
+}
+
+// addCurves adds a curve per group in the given order and compares them when there
+// are several. The curves are kept when the log-rank test cannot be computed; a
+// note says why.
+func (res *SurvivalResult) addCurves(values []any, byGroup map[any][]survivalObs) {
+	var groups [][]survivalObs
+	for _, v := range values {
+		curve := kaplanMeier(byGroup[v])
+		curve.Value = v
+		res.Curves = append(res.Curves, curve)
+		groups = append(groups, byGroup[v])
+	}
+	if len(groups) < 2 {
+		return
+	}
+	lr, err := logRank(groups)
+	if err != nil {
+		res.Notes = append(res.Notes, err.Error())
+		return
+	}
+	res.LogRank = lr
+}
+
+// eventFlag accepts 1/0, true/false, yes/no and 是/否 (case-insensitive).
+func eventFlag(v any) (bool, bool) {
+	switch x := v.(type) {
+	case int64:
+		return x != 0, x == 0 || x == 1
+	case float64:
+		return x != 0, x == 0 || x == 1
+	case []byte:
+		return eventFlag(string(x))
+	case string:
+		switch strings.ToLower(strings.TrimSpace(x)) {
+		case "1", "true", "yes", "y", "是", "有":
+			return true, true
+		case "0", "false", "no", "n", "否", "无":
+			return false, true
+		}
+	}
+	return false, false
+}
+
+// kaplanMeier builds the product-limit curve, with one point per distinct time and
+// the starting point at time 0.
+func kaplanMeier(obs []survivalObs) SurvivalCurve {
+	sort.Slice(obs, func(i, j int) bool { return obs[i].time < obs[j].time })
+	curve := SurvivalCurve{N: len(obs)}
+	curve.Points = []SurvivalPoint{{Time: 0, AtRisk: len(obs), Survival: 1, CILow: 1, CIHigh: 1}}
+	surv, greenwood := 1.0, 0.0
+	atRisk := len(obs)
+	for i := 0; i < len(obs); {
+		t := obs[i].time
+		var d, c int
+		for ; i < len(obs) && obs[i].time == t; i++ {
+			if obs[i].event {
+				d++
+			} else {
+				c++
+			}
+		}
+		curve.Events += d
+		curve.Censored += c
+		p := SurvivalPoint{Time: t, AtRisk: atRisk, Events: d, Censored: c}
+		if d > 0 {
+			surv *= 1 - float64(d)/float64(atRisk)
+			if atRisk > d {
+				greenwood += float64(d) / (float64(atRisk) * float64(atRisk-d))
+			}
+		}
+		p.Survival = surv
+		if surv > 0 {
+			half := 1.96 * math.Sqrt(greenwood)
+			p.CILow = surv * math.Exp(-half)
+			p.CIHigh = math.Min(1, surv*math.Exp(half))
+		}
+		if t == 0 && len(curve.Points) == 1 {
+			curve.Points[0] = p
+		} else {
+			curve.Points = append(curve.Points, p)
+		}
+		if curve.Median == nil && surv <= 0.5 {
+			median := t
+			curve.Median = &median
+		}
+		atRisk -= d + c
+	}
+	return curve
+}
+
+// logRank compares k curves with the Mantel-Cox log-rank test (chi-square with k-1
+// degrees of freedom).
+func logRank(groups [][]survivalObs) (*LogRankResult, error) {
+	k := len(groups)
+	type entry struct {
+		time  float64
+		group int
+		event bool
+	}
+	var all []entry
+	for g, obs := range groups {
+		for _, o := range obs {
+			all = append(all, entry{o.time, g, o.event})
+		}
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].time < all[j].time })
+	atRisk := make([]float64, k)
+	for g, obs := range groups {
+		atRisk[g] = float64(len(obs))
+	}
+	oe := make([]float64, k)
+	v := make([][]float64, k)
+	for i := range v {
+		v[i] = make([]float64, k)
+	}
+	for i := 0; i < len(all); {
+		t := all[i].time
+		dg := make([]float64, k)
+		leaving := make([]float64, k)
+		for ; i < len(all) && all[i].time == t; i++ {
+			leaving[all[i].group]++
+			if all[i].event {
+				dg[all[i].group]++
+			}
+		}
+		var n, d float64
+		for g := 0; g < k; g++ {
+			n += atRisk[g]
+			d += dg[g]
+		}
+		if d > 0 {
+			for g := 0; g < k; g++ {
+				oe[g] += dg[g] - d*atRisk[g]/n
+				if n > 1 {
+					f := d * (n - d) / (n - 1)
+					for h := 0; h < k; h++ {
+						delta := 0.0
+						if g == h {
+							delta = 1
+						}
+						v[g][h] += f * atRisk[g] / n * (delta - atRisk[h]/n)
+					}
+				}
+			}
+		}
+		for g := 0; g < k; g++ {
+			atRisk[g] -= leaving[g]
+		}
+	}
+	// The k x k covariance is singular; drop the last group.
+	m := k - 1
+	a := make([][]float64, m)
+	for i := range a {
+		a[i] = append(slices.Clone(v[i][:m]), oe[i])
+	}
+	x, err := solve(a)
+	if err != nil {
+		return nil, errors.New("没有可比较的事件，或有组在首个事件前已无随访，无法进行 log-rank 检验")
+	}
+	var stat float64
+	for i := 0; i < m; i++ {
+		stat += oe[i] * x[i]
+	}
+	df := float64(m)
+	return &LogRankResult{Statistic: stat, DF: df, PValue: chiSquareSF(stat, df)}, nil
+}
+
+// solve runs Gaussian elimination with partial pivoting on an augmented matrix.
+func solve(a [][]float64) ([]float64, error) {
+	n := len(a)
+	for col := 0; col < n; col++ {
+		pivot := col
+		for r := col + 1; r < n; r++ {
+			if math.Abs(a[r][col]) > math.Abs(a[pivot][col]) {
+				pivot = r
+			}
+		}
+		if math.Abs(a[pivot][col]) < 1e-12 {
+			return nil, errors.New("singular matrix")
+		}
+		a[col], a[pivot] = a[pivot], a[col]
+		for r := 0; r < n; r++ {
+			if r == col {
+				continue
+			}
+			f := a[r][col] / a[col][col]
+			for c := col; c <= n; c++ {
+				a[r][c] -= f * a[col][c]
+			}
+		}
+	}
+	x := make([]float64, n)
+	for i := range x {
+		x[i] = a[i][n] / a[i][i]
+	}
+	return x, nil
+}
@@ -0,0 +1,118 @@
+package storage
+
+import "testing"
+
+// Freireich et al. (1963) remission times in weeks for 6-MP and placebo; a time
+// with event false is censored.
+func freireich() (mp, placebo []survivalObs) {
+	for _, o := range []struct {
+		t     float64
+		event bool
+	}{
+		{6, true}, {6, true}, {6, true}, {6, false}, {7, true}, {9, false}, {10, true}, {10, false},
+		{11, false}, {13, true}, {16, true}, {17, false}, {19, false}, {20, false}, {22, true},
+		{23, true}, {25, false}, {32, false}, {32, false}, {34, false}, {35, false},
+	} {
+		mp = append(mp, survivalObs{o.t, o.event})
+	}
+	for _, t := range []float64{1, 1, 2, 2, 3, 4, 4, 5, 5, 8, 8, 8, 8, 11, 11, 12, 12, 15, 17, 22, 23} {
+		placebo = append(placebo, survivalObs{t, true})
+	}
+	return mp, placebo
+}
+
+func TestKaplanMeier(t *testing.T) {
+	mp, _ := freireich()
+	curve := kaplanMeier(mp)
+	if curve.N != 21 || curve.Events != 9 || curve.Censored != 12 {
+		t.Errorf("n/events/censored = %d/%d/%d, want 21/9/12", curve.N, curve.Events, curve.Censored)
+	}
+	if curve.Median == nil || *curve.Median != 23 {
+		t.Errorf("median = %v, want 23", curve.Median)
+	}
+	// R: summary(survfit(Surv(time, status) ~ 1)) for the 6-MP arm (log CI).
+	cases := []struct {
+		time           float64
+		atRisk, events int
+		surv, lo, hi   float64
+	}{
+		{6, 21, 3, 0.8571, 0.7198, 1},
+		{7, 17, 1, 0.8067, 0.6531, 0.9964},
+		{10, 15, 1, 0.7529, 0.5859, 0.9676},
+		{13, 12, 1, 0.6902, 0.5096, 0.9348},
+		{16, 11, 1, 0.6275, 0.4394, 0.8960},
+		{22, 7, 1, 0.5378, 0.3370, 0.8582},
+		{23, 6, 1, 0.4482, 0.2488, 0.8074},
+	}
+	byTime := map[float64]SurvivalPoint{}
+	for _, p := range curve.Points {
+		byTime[p.Time] = p
+	}
+	for _, c := range cases {
+		p, ok := byTime[c.time]
+		if !ok {
+			t.Errorf("no point at %v", c.time)
+			continue
+		}
+		if p.AtRisk != c.atRisk || p.Events != c.events {
+			t.Errorf("t=%v at risk/events = %d/%d, want %d/%d", c.time, p.AtRisk, p.Events, c.atRisk, c.events)
+		}
+		near(t, "survival", p.Survival, c.surv, 5e-5)
+		near(t, "ci_low", p.CILow, c.lo, 5e-5)
+		near(t, "ci_high", p.CIHigh, c.hi, 5e-5)
+	}
+	if start := curve.Points[0]; start.Time != 0 || start.Survival != 1 {
+		t.Errorf("first point = %+v, want time 0 survival 1", start)
+	}
+}
+
+func TestLogRank(t *testing.T) {
+	mp, placebo := freireich()
+	// R: survdiff(Surv(time, status) ~ group), Chisq = 16.8 on 1 df, p = 4e-05.
+	res, err := logRank([][]survivalObs{mp, placebo})
+	if err != nil {
+		t.Fatal(err)
+	}
+	near(t, "chisq", res.Statistic, 16.79294098921654, 1e-9)
+	near(t, "df", res.DF, 1, 0)
+	near(t, "p", res.PValue, 4.1688091093345274e-05, 1e-11)
+
+	// Identical groups give a statistic of 0 whatever their order.
+	same, err := logRank([][]survivalObs{placebo, placebo, placebo})
+	if err != nil {
+		t.Fatal(err)
+	}
+	near(t, "identical chisq", same.Statistic, 0, 1e-12)
+	near(t, "identical df", same.DF, 2, 0)
+}
+
+func TestSurvivalWithoutLogRank(t *testing.T) {
+	cases := []struct {
+		name   string
+		groups map[any][]survivalObs
+	}{
+		{"no events", map[any][]survivalObs{
+			"a": {{3, false}, {5, false}},
+			"b": {{4, false}, {6, false}},
+		}},
+		{"group gone before first event", map[any][]survivalObs{
+			"a": {{1, false}, {2, false}},
+			"b": {{5, true}, {6, true}},
+		}},
+	}
+	for _, c := range cases {
+		res := &SurvivalResult{}
+		res.addCurves([]any{"a", "b"}, c.groups)
+		if res.LogRank != nil || len(res.Notes) != 1 {
+			t.Errorf("%s: log rank %+v, notes %v; want none and one note", c.name, res.LogRank, res.Notes)
+		}
+		if len(res.Curves) != 2 {
+			t.Errorf("%s: %d curves, want 2", c.name, len(res.Curves))
+		}
+	}
+	res := &SurvivalResult{}
+	res.addCurves([]any{"b"}, map[any][]survivalObs{"b": {{5, true}, {6, true}}})
+	if res.Curves[0].Median == nil || *res.Curves[0].Median != 5 {
+		t.Errorf("single curve median = %v, want 5", res.Curves[0].Median)
+	}
+}
@@ -0,0 +1,177 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// maxBuckets keeps a daily series over many years from producing a huge response.
+const maxBuckets = 5000
+
+// TimeSeriesRequest buckets rows by DateColumn. Without Column each bucket only
+// counts rows; with it Agg (sum/avg/min/max/median) is applied to that numeric
+// column as well.
+type TimeSeriesRequest struct {
+	DateColumn string
+	Interval   string
+	Column     string
+	Agg        string
+}
+
+// TimeBucket is one period. Start is the first day of the period; Value is null
+// when the bucket has no numeric values.
+type TimeBucket struct {
+	Key   string   `json:"key"`
+	Start string   `json:"start"`
+	Count int      `json:"count"`
+	Value *float64 `json:"value,omitempty"`
+}
+
+// TimeSeriesResult lists every period between the first and the last date, empty
+// ones included, so charts need no gap filling. Excluded counts unparseable dates.
+type TimeSeriesResult struct {
+	Interval string       `json:"interval"`
+	Agg      string       `json:"agg"`
+	Buckets  []TimeBucket `json:"buckets"`
+	Excluded int          `json:"excluded"`
+}
+
+var seriesAggs = map[string]string{
+	"sum":    "sum",
+	"avg":    "average",
+	"min":    "min",
+	"max":    "max",
+	"median": "median",
+}
+
+func (s *Storage) TimeSeries(ctx context.Context, table string, req TimeSeriesRequest, opts QueryOptions) (*TimeSeriesResult, error) {
+	defs, err := s.columnDefs(ctx, table)
+	if err != nil {
+		return nil, err
+	}
+	if def, ok := defs[req.DateColumn]; !ok || !isDateHint(def.TypeHint) {
+		return nil, filterErr("字段 %s 不存在或不是日期类型", req.DateColumn)
+	}
+	if req.Interval == "" {
+		req.Interval = "month"
+	}
+	if _, ok := periodStart(time.Time{}, req.Interval); !ok {
+		return nil, filterErr("不支持的时间粒度 %s（可选 day/week/month/year）", req.Interval)
+	}
+	valueExpr := "NULL"
+	if req.Column != "" {
+		if def, ok := defs[req.Column]; !ok || !isNumericHint(def.TypeHint) {
+			return nil, filterErr("字段 %s 不存在或不是数值类型", req.Column)
+		}
+		if req.Agg == "" {
+			req.Agg = "avg"
+		}
+		if _, ok := seriesAggs[req.Agg]; !ok {
+			return nil, filterErr("不支持的汇总方式 %s", req.Agg)
+		}
+		valueExpr = qualify(table, req.Column)
+	} else {
+		req.Agg = "count"
+	}
+	sc, err := s.scopeRows(ctx, table, opts)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.db.QueryContext(ctx, sc.query(qualify(table, req.DateColumn)+", "+valueExpr, ""), sc.params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	res := &TimeSeriesResult{Interval: req.Interval, Agg: req.Agg, Buckets: []TimeBucket{}}
+	counts := map[time.Time]int{}
+	values := map[time.Time]*sample{}
+	var first, last time.Time
+	for rows.Next() {
+		var d, v any
+		if err := rows.Scan(&d, &v); err != nil {
+			return nil, err
+		}
+		t, ok := parseDate(d)
+		if !ok {
+			res.Excluded++
+			continue
+		}
+		start, _ := periodStart(t, req.Interval)
+		if first.IsZero() || start.Before(first) {
+			first = start
+		}
+		if start.After(last) {
+			last = start
+		}
+		counts[start]++
+		if req.Column != "" {
+			if values[start] == nil {
+				values[start] = &sample{}
+			}
+			values[start].add(v)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(counts) == 0 {
+		return res, nil
+	}
+	for t := first; !t.After(last); t = nextPeriod(t, req.Interval) {
+		if len(res.Buckets) == maxBuckets {
+			return nil, filterErr("时间段超过 %d 个，请选择更粗的粒度或缩小范围", maxBuckets)
+		}
+		b := TimeBucket{Key: periodKey(t, req.Interval), Start: t.Format("2006-01-02"), Count: counts[t]}
+		if sm := values[t]; sm != nil && len(sm.nums) > 0 {
+			v := describe(sm, nil)[seriesAggs[req.Agg]]
+			b.Value = &v
+		}
+		res.Buckets = append(res.Buckets, b)
+	}
+	return res, nil
+}
+
+// periodStart truncates t to the start of its day, ISO week (Monday), month or year.
+func periodStart(t time.Time, interval string) (time.Time, bool) {
+	y, m, d := t.Date()
+	day := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	switch interval {
+	case "day":
+		return day, true
+	case "week":
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7)), true
+	case "month":
+		return time.Date(y, m, 1, 0, 0, 0, 0, time.UTC), true
+	case "year":
+		return time.Date(y, 1, 1, 0, 0, 0, 0, time.UTC), true
+	}
+	return time.Time{}, false
+}
+
+func nextPeriod(t time.Time, interval string) time.Time {
+	switch interval {
+	case "day":
+		return t.AddDate(0, 0, 1)
+	case "week":
+		return t.AddDate(0, 0, 7)
+	case "month":
+		return t.AddDate(0, 1, 0)
+	default:
+		return t.AddDate(1, 0, 0)
+	}
+}
+
+func periodKey(t time.Time, interval string) string {
+	switch interval {
+	case "day":
+		return t.Format("2006-01-02")
+	case "week":
+		y, w := t.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", y, w)
+	case "month":
+		return t.Format("2006-01")
+	default:
+		return t.Format("2006")
+	}
+}
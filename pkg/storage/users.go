@@ -0,0 +1,208 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	RoleAdmin     = "admin"
+	RoleDataEntry = "data_entry"
+	RoleAnalyst   = "analyst"
+)
+
+var ErrInvalidCredentials = errors.New("用户名或密码错误")
+
+type User struct {
+	ID          int64     `json:"id"`
+	Username    string    `json:"username"`
+	DisplayName string    `json:"display_name"`
+	Role        string    `json:"role"`
+	Disabled    bool      `json:"disabled"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+func (u *User) IsAdmin() bool {
+	return u != nil && u.Role == RoleAdmin
+}
+
+func (s *Storage) ensureUsers() error {
+	_, err := s.db.Exec(`CREATE TABLE IF NOT EXISTS users (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		username TEXT NOT NULL UNIQUE,
+		password_hash TEXT NOT NULL,
+		display_name TEXT,
+		role TEXT NOT NULL DEFAULT 'data_entry',
+		disabled INTEGER DEFAULT 0,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`)
+	return err
+}
+
+// EnsureAdmin seeds the first admin account from config when no user exists yet.
+func (s *Storage) EnsureAdmin(ctx context.Context, username, password string) error {
+	var count int
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(1) FROM users`).Scan(&count); err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	if username == "" || password == "" {
+		return errors.New("缺少初始管理员账号配置")
+	}
+	s.l.Info("seed admin user", zap.String("username", username))
+	_, err := s.CreateUser(ctx, User{Username: username, DisplayName: "管理员", Role: RoleAdmin}, password)
+	return err
+}
+
+func (s *Storage) CreateUser(ctx context.Context, u User, password string) (int64, error) {
+	u.Username = strings.TrimSpace(u.Username)
+	if u.Username == "" {
+		return 0, errors.New("用户名不能为空")
+	}
+	if password == "" {
+		return 0, errors.New("密码不能为空")
+	}
+	if u.Role == "" {
+		u.Role = RoleDataEntry
+	}
+	if !validRole(u.Role) {
+		return 0, fmt.Errorf("未知角色 %s", u.Role)
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return 0, err
+	}
+	res, err := s.db.ExecContext(ctx, `INSERT INTO users(username, password_hash, display_name, role) VALUES(?,?,?,?)`,
+		u.Username, hash, u.DisplayName, u.Role)
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE") {
+			return 0, fmt.Errorf("用户名 %s 已存在", u.Username)
+		}
+		s.l.Error("create user failed", zap.String("username", u.Username), zap.Error(err))
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+func (s *Storage) ListUsers(ctx context.Context) ([]User, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT id, username, COALESCE(display_name,''), role, disabled, created_at, updated_at FROM users ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var users []User
+	for rows.Next() {
+		var u User
+		if err := rows.Scan(&u.ID, &u.Username, &u.DisplayName, &u.Role, &u.Disabled, &u.CreatedAt, &u.UpdatedAt); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+func (s *Storage) GetUser(ctx context.Context, id int64) (*User, error) {
+	var u User
+	err := s.db.QueryRowContext(ctx, `SELECT id, username, COALESCE(display_name,''), role, disabled, created_at, updated_at FROM users WHERE id=?`, id).
+		Scan(&u.ID, &u.Username, &u.DisplayName, &u.Role, &u.Disabled, &u.CreatedAt, &u.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("用户 %d 不存在", id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// Authenticate checks the password against the stored hash; disabled users are rejected.
+func (s *Storage) Authenticate(ctx context.Context, username, password string) (*User, error) {
+	var u User
+	var hash string
+	err := s.db.QueryRowContext(ctx, `SELECT id, username, COALESCE(display_name,''), role, disabled, created_at, updated_at, password_hash FROM users WHERE username=?`, username).
+		Scan(&u.ID, &u.Username, &u.DisplayName, &u.Role, &u.Disabled, &u.CreatedAt, &u.UpdatedAt, &hash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil {
+		return nil, ErrInvalidCredentials
+	}
+	if u.Disabled {
+		return nil, errors.New("账号已停用")
+	}
+	return &u, nil
+}
+
+func (s *Storage) SetUserDisabled(ctx context.Context, id int64, disabled bool) error {
+	if err := s.updateUser(ctx, id, `UPDATE users SET disabled=?, updated_at=CURRENT_TIMESTAMP WHERE id=?`, boolToInt(disabled), id); err != nil {
+		return err
+	}
+	if disabled {
+		_, err := s.RevokeUserSessions(ctx, id)
+		return err
+	}
+	return nil
+}
+
+func (s *Storage) SetUserRole(ctx context.Context, id int64, role string) error {
+	if !validRole(role) {
+		return fmt.Errorf("未知角色 %s", role)
+	}
+	return s.updateUser(ctx, id, `UPDATE users SET role=?, updated_at=CURRENT_TIMESTAMP WHERE id=?`, role, id)
+}
+
+func (s *Storage) ResetPassword(ctx context.Context, id int64, password string) error {
+	if password == "" {
+		return errors.New("密码不能为空")
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+	if err := s.updateUser(ctx, id, `UPDATE users SET password_hash=?, updated_at=CURRENT_TIMESTAMP WHERE id=?`, hash, id); err != nil {
+		return err
+	}
+	_, err = s.RevokeUserSessions(ctx, id)
+	return err
+}
+
+func (s *Storage) updateUser(ctx context.Context, id int64, stmt string, args ...any) error {
+	res, err := s.db.ExecContext(ctx, stmt, args...)
+	if err != nil {
+		s.l.Error("update user failed", zap.Int64("id", id), zap.Error(err))
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("用户 %d 不存在", id)
+	}
+	return nil
+}
+
+func hashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func validRole(role string) bool {
+	switch role {
+	case RoleAdmin, RoleDataEntry, RoleAnalyst:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,156 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// SavedView is a named query layout on one table: filters, search, sort and the
+// visible columns in display order. Views are shared with everyone who can read
+// the table; only the owner or an admin may change them.
+type SavedView struct {
+	ID        int64        `json:"id"`
+	TableName string       `json:"table_name"`
+	Name      string       `json:"name"`
+	Options   QueryOptions `json:"options"`
+	Columns   []string     `json:"columns"`
+	OwnerID   int64        `json:"owner_id"`
+	OwnerName string       `json:"owner_name"`
+	CreatedAt string       `json:"created_at"`
+	UpdatedAt string       `json:"updated_at"`
+}
+
+func (s *Storage) ensureViews() error {
+	ddl := []string{
+		`CREATE TABLE IF NOT EXISTS saved_views (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			table_name TEXT NOT NULL,
+			name TEXT NOT NULL,
+			options_json TEXT,
+			columns_json TEXT,
+			owner_id INTEGER,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_saved_views_table ON saved_views(table_name);`,
+	}
+	for _, stmt := range ddl {
+		if _, err := s.db.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const viewSelect = `SELECT v.id, v.table_name, v.name, COALESCE(v.options_json,'{}'), COALESCE(v.columns_json,'[]'),
+	COALESCE(v.owner_id,0), COALESCE(u.username,''),
+	strftime('%Y-%m-%d %H:%M:%S', v.created_at), strftime('%Y-%m-%d %H:%M:%S', v.updated_at)
+	FROM saved_views v LEFT JOIN users u ON u.id=v.owner_id`
+
+func scanView(scan func(dest ...any) error) (*SavedView, error) {
+	var v SavedView
+	var opts, cols string
+	if err := scan(&v.ID, &v.TableName, &v.Name, &opts, &cols, &v.OwnerID, &v.OwnerName, &v.CreatedAt, &v.UpdatedAt); err != nil {
+		return nil, err
+	}
+	_ = json.Unmarshal([]byte(opts), &v.Options)
+	_ = json.Unmarshal([]byte(cols), &v.Columns)
+	return &v, nil
+}
+
+func (s *Storage) ListViews(ctx context.Context, table string) ([]SavedView, error) {
+	rows, err := s.db.QueryContext(ctx, viewSelect+` WHERE v.table_name=? ORDER BY v.name`, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	views := []SavedView{}
+	for rows.Next() {
+		v, err := scanView(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		views = append(views, *v)
+	}
+	return views, rows.Err()
+}
+
+func (s *Storage) GetView(ctx context.Context, table string, id int64) (*SavedView, error) {
+	v, err := scanView(s.db.QueryRowContext(ctx, viewSelect+` WHERE v.table_name=? AND v.id=?`, table, id).Scan)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("视图 %d 不存在", id)
+	}
+	return v, err
+}
+
+func (s *Storage) CreateView(ctx context.Context, v SavedView) (int64, error) {
+	if err := s.validateView(ctx, &v); err != nil {
+		return 0, err
+	}
+	opts, _ := json.Marshal(v.Options)
+	cols, _ := json.Marshal(v.Columns)
+	res, err := s.db.ExecContext(ctx, `INSERT INTO saved_views(table_name, name, options_json, columns_json, owner_id) VALUES(?,?,?,?,?)`,
+		v.TableName, v.Name, string(opts), string(cols), actorFrom(ctx).UserID)
+	if err != nil {
+		s.l.Error("create view failed", zap.String("table", v.TableName), zap.Error(err))
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+func (s *Storage) UpdateView(ctx context.Context, v SavedView) error {
+	if err := s.validateView(ctx, &v); err != nil {
+		return err
+	}
+	opts, _ := json.Marshal(v.Options)
+	cols, _ := json.Marshal(v.Columns)
+	res, err := s.db.ExecContext(ctx, `UPDATE saved_views SET name=?, options_json=?, columns_json=?, updated_at=CURRENT_TIMESTAMP
+		WHERE table_name=? AND id=?`, v.Name, string(opts), string(cols), v.TableName, v.ID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("视图 %d 不存在", v.ID)
+	}
+	return nil
+}
+
+func (s *Storage) DeleteView(ctx context.Context, table string, id int64) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM saved_views WHERE table_name=? AND id=?`, table, id)
+	return err
+}
+
+func (s *Storage) validateView(ctx context.Context, v *SavedView) error {
+	v.Name = strings.TrimSpace(v.Name)
+	if v.Name == "" {
+		return errors.New("视图名称不能为空")
+	}
+	columns, err := s.tableColumns(ctx, v.TableName)
+	if err != nil {
+		return err
+	}
+	for _, col := range v.Columns {
+		if col != "id" && !slices.Contains(columns, col) {
+			return fmt.Errorf("字段 %s 不存在", col)
+		}
+	}
+	// Paging belongs to the caller, not the view.
+	v.Options.Page = 0
+	v.Options.Cursor = ""
+	v.Options.Columns = nil
+	return nil
+}
+
+// Apply returns the view's stored options with its visible columns attached.
+func (v *SavedView) Apply() QueryOptions {
+	opts := v.Options
+	opts.Columns = v.Columns
+	return opts
+}